@@ -0,0 +1,247 @@
+package webrtcsignalingserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aliforever/go-httpjson"
+)
+
+// AdminListener is a registered listener as /admin/listeners lists it.
+type AdminListener struct {
+	Id        string        `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	State     ListenerState `json:"state"`
+	// Sessions open on a session listener, see AddSDPSessionListener
+	Sessions *int `json:"sessions,omitempty"`
+}
+
+// AdminStoredSDP is a stored SDP as /admin/sdps lists it, without the SDP.
+type AdminStoredSDP struct {
+	Id        string            `json:"id"`
+	Type      string            `json:"type"`
+	Size      int               `json:"size"`
+	Data      map[string]string `json:"data,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+}
+
+// AdminStatus is what /admin/status shows.
+type AdminStatus struct {
+	StartedAt         time.Time   `json:"started_at"`
+	UptimeSeconds     int64       `json:"uptime_seconds"`
+	Closing           bool        `json:"closing"`
+	PendingHandshakes int         `json:"pending_handshakes"`
+	Config            AdminConfig `json:"config"`
+}
+
+// AdminConfig is how the server was configured with its Options.
+type AdminConfig struct {
+	Storage              string     `json:"storage"`
+	HandshakeTimeout     string     `json:"handshake_timeout"`
+	StoredSDPTTL         string     `json:"stored_sdp_ttl"`
+	MaxStoredSDPTTL      string     `json:"max_stored_sdp_ttl"`
+	MaxPendingHandshakes int        `json:"max_pending_handshakes"`
+	MaxStoredSDPs        int        `json:"max_stored_sdps"`
+	IPRateLimit          *RateLimit `json:"ip_rate_limit,omitempty"`
+	IDRateLimit          *RateLimit `json:"id_rate_limit,omitempty"`
+	Authentication       bool       `json:"authentication"`
+	// Whether Start or ListenTLS serve over TLS, false for a mounted Handler
+	TLS                bool             `json:"tls"`
+	ClientCertificates bool             `json:"client_certificates"`
+	SDPMiddleware      int              `json:"sdp_middleware"`
+	CandidatePolicy    *CandidatePolicy `json:"candidate_policy,omitempty"`
+	Metrics            bool             `json:"metrics"`
+}
+
+func (ss *SignalingServer) registerAdmin(m *http.ServeMux) {
+	m.HandleFunc("/admin/listeners", ss.wrapAdmin("admin_listeners", ss.adminListenersHandler))
+	m.HandleFunc("/admin/sdps", ss.wrapAdmin("admin_sdps", ss.adminSDPsHandler))
+	m.HandleFunc("/admin/status", ss.wrapAdmin("admin_status", ss.adminStatusHandler))
+}
+
+// wrapAdmin is wrap for the admin endpoints, which authenticate with the admin
+// Authenticator instead and stay up while the server shuts down.
+func (ss *SignalingServer) wrapAdmin(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return ss.correlate(endpoint, ss.trace(endpoint, ss.instrument(endpoint, ss.limitIP(ss.authenticateAdmin(handler)))))
+}
+
+func (ss *SignalingServer) authenticateAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		principal, err := ss.adminAuthenticator.Authenticate(request)
+		if err != nil {
+			writeError(writer, asError(err, ErrUnauthorized))
+			return
+		}
+
+		handler(writer, request.WithContext(ContextWithPrincipal(request.Context(), principal)))
+	}
+}
+
+// adminListenersHandler lists listeners on GET and closes the one of id on
+// DELETE, so whoever waits on it gets ErrListenerClosed.
+func (ss *SignalingServer) adminListenersHandler(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		ids, err := ss.storage.ListSDPListeners()
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		listeners := []*AdminListener{}
+		for _, id := range ids {
+			l, err := ss.storage.FindSDPListener(id)
+			if err != nil {
+				// Removed since it was listed
+				continue
+			}
+
+			listener := &AdminListener{Id: id, CreatedAt: l.CreatedAt(), State: l.State()}
+			if l.IsSessionListener() {
+				sessions := l.sessionCount()
+				listener.Sessions = &sessions
+			}
+			listeners = append(listeners, listener)
+		}
+
+		httpjson.Ok(writer, listeners)
+	case http.MethodDelete:
+		id := request.URL.Query().Get("id")
+		if id == "" {
+			writeError(writer, ErrEmptyID)
+			return
+		}
+
+		l, err := ss.storage.FindSDPListener(id)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		l.Close(ErrListenerClosed)
+
+		err = ss.storage.RemoveSDPListener(id)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		ss.requestLogger(request.Context()).Info("listener closed", "id", id)
+		httpjson.Ok(writer, "success")
+	default:
+		writeError(writer, ErrMethodNotAllowed)
+	}
+}
+
+// adminSDPsHandler lists stored SDPs on GET and deletes the one of id on
+// DELETE.
+func (ss *SignalingServer) adminSDPsHandler(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		ids, err := ss.storage.ListSDPsInStorage()
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		sdps := []*AdminStoredSDP{}
+		for _, id := range ids {
+			stored, err := ss.storage.GetSDPFromStorage(id)
+			if err != nil {
+				// Expired or consumed since it was listed
+				continue
+			}
+
+			sdp := &AdminStoredSDP{
+				Id:        id,
+				Type:      stored.SDP.SDP().Type.String(),
+				Size:      len(stored.SDP.SDP().SDP),
+				Data:      stored.SDP.Data(),
+				CreatedAt: stored.CreatedAt,
+			}
+			if !stored.ExpiresAt.IsZero() {
+				sdp.ExpiresAt = &stored.ExpiresAt
+			}
+			sdps = append(sdps, sdp)
+		}
+
+		httpjson.Ok(writer, sdps)
+	case http.MethodDelete:
+		id := request.URL.Query().Get("id")
+		if id == "" {
+			writeError(writer, ErrEmptyID)
+			return
+		}
+
+		err := ss.storage.DeleteSDPFromStorage(id)
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		ss.requestLogger(request.Context()).Info("stored SDP deleted", "id", id)
+		httpjson.Ok(writer, "success")
+	default:
+		writeError(writer, ErrMethodNotAllowed)
+	}
+}
+
+func (ss *SignalingServer) adminStatusHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, ErrMethodNotAllowed)
+		return
+	}
+
+	httpjson.Ok(writer, ss.Status())
+}
+
+// Status is the uptime, load and configuration of the server, as
+// /admin/status shows it.
+func (ss *SignalingServer) Status() (status *AdminStatus) {
+	ss.lifecycle.m.Lock()
+	closing, serveTLS := ss.lifecycle.closing, ss.lifecycle.tls
+	ss.lifecycle.m.Unlock()
+
+	// The candidate policy runs as the last middleware, it is reported on its own
+	middleware := len(ss.sdpMiddleware)
+	if ss.candidatePolicy != nil {
+		middleware--
+	}
+
+	ss.pendingM.Lock()
+	pending := ss.pendingHandshakes
+	ss.pendingM.Unlock()
+
+	status = &AdminStatus{
+		StartedAt:         ss.startedAt,
+		UptimeSeconds:     int64(time.Since(ss.startedAt).Seconds()),
+		Closing:           closing,
+		PendingHandshakes: pending,
+		Config: AdminConfig{
+			Storage:              fmt.Sprintf("%T", ss.storage),
+			HandshakeTimeout:     ss.handshakeTimeout.String(),
+			StoredSDPTTL:         ss.storedSDPTTL.String(),
+			MaxStoredSDPTTL:      ss.maxStoredSDPTTL.String(),
+			MaxPendingHandshakes: ss.maxPendingHandshakes,
+			MaxStoredSDPs:        ss.maxStoredSDPs,
+			Authentication:       ss.authenticator != nil,
+			TLS:                  serveTLS,
+			ClientCertificates:   ss.clientCAs != nil,
+			SDPMiddleware:        middleware,
+			CandidatePolicy:      ss.candidatePolicy,
+			Metrics:              ss.metrics != nil,
+		},
+	}
+
+	if ss.ipLimiter != nil {
+		status.Config.IPRateLimit = &ss.ipLimiter.limit
+	}
+
+	if ss.idLimiter != nil {
+		status.Config.IDRateLimit = &ss.idLimiter.limit
+	}
+
+	return
+}
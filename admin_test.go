@@ -0,0 +1,174 @@
+package webrtcsignalingserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSignalingServer_Admin(t *testing.T) {
+	ss := New(WithAdmin(NewBearerAuthenticator(map[string]string{"admin-token": "ops"})))
+
+	server := httptest.NewServer(ss.Handler())
+	defer server.Close()
+
+	admin := func(method, path string, destination interface{}) int {
+		t.Helper()
+
+		request, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Authorization", "Bearer admin-token")
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+
+		if destination != nil {
+			envelope := struct {
+				Data interface{} `json:"data"`
+			}{Data: destination}
+			if err = json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return response.StatusCode
+	}
+
+	response, err := http.Get(server.URL + "/admin/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("/admin/status without a token = %d, want 401", response.StatusCode)
+	}
+
+	idle, err := ss.AddSDPListener("idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delivered, err := ss.AddSDPListener("delivered")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go http.Post(server.URL+"/sdp_inform", "application/json", strings.NewReader(`{"id":"delivered","sdp":"`+offer+`"}`))
+	if _, err = delivered.ReadSDPClientContext(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err = http.Post(server.URL+"/sdp_store", "application/json", strings.NewReader(`{"id":"stored","sdp":"`+offer+`","data":{"room":"lobby"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	var listeners []*AdminListener
+	if status := admin(http.MethodGet, "/admin/listeners", &listeners); status != http.StatusOK {
+		t.Fatalf("GET /admin/listeners = %d", status)
+	}
+
+	states := map[string]ListenerState{}
+	for _, listener := range listeners {
+		states[listener.Id] = listener.State
+	}
+	if states["idle"] != ListenerIdle || states["delivered"] != ListenerClientDelivered {
+		t.Errorf("listener states = %v", states)
+	}
+
+	var sdps []*AdminStoredSDP
+	admin(http.MethodGet, "/admin/sdps", &sdps)
+	if len(sdps) != 1 || sdps[0].Id != "stored" || sdps[0].Type != "offer" || sdps[0].Data["room"] != "lobby" || sdps[0].Size != len(testOfferSDP) {
+		t.Errorf("GET /admin/sdps = %+v", sdps)
+	}
+
+	if status := admin(http.MethodDelete, "/admin/sdps?id=stored", nil); status != http.StatusOK {
+		t.Errorf("DELETE /admin/sdps = %d", status)
+	}
+	if _, err = ss.storage.GetSDPFromStorage("stored"); !errors.Is(err, ErrSDPNotFound) {
+		t.Errorf("deleted SDP is still stored: %v", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := idle.ReadSDPClientContext(t.Context())
+		waited <- err
+	}()
+
+	if status := admin(http.MethodDelete, "/admin/listeners?id=idle", nil); status != http.StatusOK {
+		t.Errorf("DELETE /admin/listeners = %d", status)
+	}
+	if err = <-waited; !errors.Is(err, ErrListenerClosed) {
+		t.Errorf("waiter got %v, want %v", err, ErrListenerClosed)
+	}
+	if status := admin(http.MethodDelete, "/admin/listeners?id=idle", nil); status != http.StatusNotFound {
+		t.Errorf("DELETE /admin/listeners of a closed listener = %d, want 404", status)
+	}
+
+	var status AdminStatus
+	admin(http.MethodGet, "/admin/status", &status)
+	if status.StartedAt.IsZero() || status.Config.HandshakeTimeout != DefaultHandshakeTimeout.String() || status.Config.Storage != "*webrtcsignalingserver.MemoryStorage" {
+		t.Errorf("GET /admin/status = %+v", status)
+	}
+}
+
+func TestSignalingServer_StatusConfig(t *testing.T) {
+	passThrough := SDPMiddlewareFunc(func(*SDPRewrite) error { return nil })
+
+	tests := []struct {
+		name           string
+		options        []Option
+		start          bool
+		wantTLS        bool
+		wantMiddleware int
+	}{
+		{name: "plain", start: true},
+		{name: "tls config unused", options: []Option{WithTLSConfig(&tls.Config{})}},
+		{name: "tls config", options: []Option{WithTLSConfig(&tls.Config{})}, start: true, wantTLS: true},
+		{name: "client certificates", options: []Option{WithClientCertificates(x509.NewCertPool())}, start: true, wantTLS: true},
+		{name: "candidate policy", options: []Option{WithCandidatePolicy(CandidatePolicy{DropHost: true})}},
+		{
+			name:           "middleware and candidate policy",
+			options:        []Option{WithSDPMiddleware(passThrough), WithCandidatePolicy(CandidatePolicy{DropHost: true})},
+			wantMiddleware: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ss := New(test.options...)
+			if test.start {
+				if err := ss.Start("127.0.0.1:0"); err != nil {
+					t.Fatal(err)
+				}
+				defer ss.Shutdown(t.Context())
+			}
+
+			config := ss.Status().Config
+			if config.TLS != test.wantTLS {
+				t.Errorf("Status().Config.TLS = %v, want %v", config.TLS, test.wantTLS)
+			}
+			if config.SDPMiddleware != test.wantMiddleware {
+				t.Errorf("Status().Config.SDPMiddleware = %d, want %d", config.SDPMiddleware, test.wantMiddleware)
+			}
+		})
+	}
+}
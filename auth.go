@@ -0,0 +1,91 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"net/http"
+)
+
+// Principal is whoever an Authenticator recognized on a request.
+type Principal struct {
+	Subject string `json:"subject"`
+	// Method names the Authenticator that recognized it, e.g. "bearer"
+	Method string `json:"method"`
+	// Role and Audience scope what the principal may do, see Authorizer
+	Role     string            `json:"role,omitempty"`
+	Audience []string          `json:"audience,omitempty"`
+	Claims   map[string]string `json:"claims,omitempty"`
+}
+
+// Authenticator is consulted before every endpoint when set with
+// WithAuthenticator. Returning an error rejects the request with 401 and the
+// error as its message.
+type Authenticator interface {
+	Authenticate(request *http.Request) (principal *Principal, err error)
+}
+
+// Action is what a request does to the listener, stored SDP or room it names.
+type Action string
+
+const (
+	ActionHandshake Action = "handshake"
+	ActionInform    Action = "inform"
+	ActionStore     Action = "store"
+	ActionFetch     Action = "fetch"
+	ActionCandidate Action = "candidate"
+	ActionRoom      Action = "room"
+)
+
+// Authorizer is implemented by Authenticators that also scope principals to
+// ids. Once a request names its listener, stored SDP or room, the endpoint
+// rejects it with 403 unless Authorize returns nil.
+type Authorizer interface {
+	Authorize(principal *Principal, action Action, id string) (err error)
+}
+
+type principalContextKey struct{}
+
+// ContextWithPrincipal attaches principal to ctx. Client SDPs delivered with
+// such a context carry it, see SDPClient.Principal.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (principal *Principal) {
+	principal, _ = ctx.Value(principalContextKey{}).(*Principal)
+	return
+}
+
+// authenticate runs the Authenticator in front of handler, if there is one.
+func (ss *SignalingServer) authenticate(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if ss.authenticator == nil {
+			handler(writer, request)
+			return
+		}
+
+		principal, err := ss.authenticator.Authenticate(request)
+		if err != nil {
+			writeError(writer, asError(err, ErrUnauthorized))
+			return
+		}
+
+		handler(writer, request.WithContext(ContextWithPrincipal(request.Context(), principal)))
+	}
+}
+
+// authorize writes a 403 and returns false when the Authenticator scopes
+// principals and the one of request may not do action on id.
+func (ss *SignalingServer) authorize(writer http.ResponseWriter, request *http.Request, action Action, id string) bool {
+	authorizer, ok := ss.authenticator.(Authorizer)
+	if !ok {
+		return true
+	}
+
+	err := authorizer.Authorize(PrincipalFromContext(request.Context()), action, id)
+	if err != nil {
+		writeError(writer, asError(err, ErrForbidden))
+		return false
+	}
+
+	return true
+}
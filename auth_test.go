@@ -0,0 +1,134 @@
+package webrtcsignalingserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestBearerAuthenticator(t *testing.T) {
+	authenticator := NewBearerAuthenticator(map[string]string{"secret-token": "backend"})
+
+	tests := []struct {
+		name        string
+		header      string
+		value       string
+		url         string
+		wantSubject string
+		wantErr     bool
+	}{
+		{name: "bearer", header: "Authorization", value: "Bearer secret-token", url: "/", wantSubject: "backend"},
+		{name: "api_key", header: "X-API-Key", value: "secret-token", url: "/", wantSubject: "backend"},
+		{name: "query", url: "/ws?access_token=secret-token", wantSubject: "backend"},
+		{name: "missing", url: "/", wantErr: true},
+		{name: "wrong_token", header: "Authorization", value: "Bearer guess", url: "/", wantErr: true},
+		{name: "wrong_scheme", header: "Authorization", value: "Basic secret-token", url: "/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, tt.url, nil)
+			if tt.header != "" {
+				request.Header.Set(tt.header, tt.value)
+			}
+
+			principal, err := authenticator.Authenticate(request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && principal.Subject != tt.wantSubject {
+				t.Errorf("Authenticate() subject = %q, want %q", principal.Subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	authenticator := NewHMACAuthenticator([]byte("secret"))
+
+	u, _ := url.Parse("/sdp_handshake?room=call")
+	signed := authenticator.SignURL(http.MethodPost, u, "viewer-1", "publisher", time.Now().Add(time.Minute))
+
+	principal, err := authenticator.Authenticate(httptest.NewRequest(http.MethodPost, signed.String(), nil))
+	if err != nil || principal.Subject != "viewer-1" || principal.Method != "hmac" {
+		t.Fatalf("Authenticate() = %+v, %v", principal, err)
+	}
+
+	if err = authenticator.Authorize(principal, ActionHandshake, "publisher"); err != nil {
+		t.Errorf("Authorize() for the signed id = %v", err)
+	}
+	if err = authenticator.Authorize(principal, ActionHandshake, "other"); err != ErrSignatureNotValidForID {
+		t.Errorf("Authorize() for another id = %v, want %v", err, ErrSignatureNotValidForID)
+	}
+
+	rebound := *signed
+	rebound.RawQuery = strings.Replace(rebound.RawQuery, "signed_id=publisher", "signed_id=other", 1)
+	if _, err = authenticator.Authenticate(httptest.NewRequest(http.MethodPost, rebound.String(), nil)); err == nil {
+		t.Error("Authenticate() accepted a URL with another id")
+	}
+
+	tampered := *signed
+	tampered.RawQuery = strings.Replace(tampered.RawQuery, "room=call", "room=other", 1)
+	if _, err = authenticator.Authenticate(httptest.NewRequest(http.MethodPost, tampered.String(), nil)); err == nil {
+		t.Error("Authenticate() accepted a tampered URL")
+	}
+
+	if _, err = authenticator.Authenticate(httptest.NewRequest(http.MethodGet, signed.String(), nil)); err == nil {
+		t.Error("Authenticate() accepted a URL signed for another method")
+	}
+
+	expired := authenticator.SignURL(http.MethodPost, u, "viewer-1", "publisher", time.Now().Add(-time.Second))
+	if _, err = authenticator.Authenticate(httptest.NewRequest(http.MethodPost, expired.String(), nil)); err == nil {
+		t.Error("Authenticate() accepted an expired URL")
+	}
+}
+
+func TestSignalingServer_Authenticator(t *testing.T) {
+	ss := New(WithAuthenticator(NewBearerAuthenticator(map[string]string{"secret-token": "viewer"})))
+
+	m := http.NewServeMux()
+	ss.register(m)
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"id":"publisher","sdp":"` + testOfferBase64(t) + `"}`
+
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+
+	principals := make(chan *Principal, 1)
+	go func() {
+		clientSDP, err := listener.ReadSDPClientContext(t.Context())
+		if err != nil {
+			principals <- nil
+			return
+		}
+
+		principals <- clientSDP.Principal()
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}, nil)
+	}()
+
+	request := httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret-token")
+
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("authenticated status = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if principal := <-principals; principal == nil || principal.Subject != "viewer" {
+		t.Errorf("SDPClient.Principal() = %+v, want the viewer", principal)
+	}
+}
@@ -0,0 +1,67 @@
+package webrtcsignalingserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// BearerAuthenticator accepts a fixed set of tokens, sent as
+// "Authorization: Bearer <token>", as an "X-API-Key" header or, for browsers
+// opening a websocket, as the access_token query parameter.
+type BearerAuthenticator struct {
+	tokens map[string]string
+}
+
+// NewBearerAuthenticator maps every accepted token to the subject it
+// authenticates.
+func NewBearerAuthenticator(tokens map[string]string) *BearerAuthenticator {
+	copied := make(map[string]string, len(tokens))
+	for token, subject := range tokens {
+		copied[token] = subject
+	}
+
+	return &BearerAuthenticator{tokens: copied}
+}
+
+func (ba *BearerAuthenticator) Authenticate(request *http.Request) (principal *Principal, err error) {
+	token := bearerToken(request)
+	if token == "" {
+		err = ErrMissingCredentials
+		return
+	}
+
+	// Compare against every token so timing does not tell how close a guess was
+	var subject string
+	var found bool
+	for known, knownSubject := range ba.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			subject, found = knownSubject, true
+		}
+	}
+
+	if !found {
+		err = ErrInvalidCredentials
+		return
+	}
+
+	principal = &Principal{Subject: subject, Method: "bearer"}
+	return
+}
+
+func bearerToken(request *http.Request) string {
+	if authorization := request.Header.Get("Authorization"); authorization != "" {
+		scheme, token, _ := strings.Cut(authorization, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+
+		return ""
+	}
+
+	if key := request.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	return request.URL.Query().Get("access_token")
+}
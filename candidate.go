@@ -0,0 +1,33 @@
+package webrtcsignalingserver
+
+import (
+	"github.com/pion/webrtc/v3"
+)
+
+// Candidate is a trickled ICE candidate. A Candidate with EndOfCandidates set
+// carries no candidate and marks that the sending side finished gathering.
+type Candidate struct {
+	Candidate       *webrtc.ICECandidateInit `json:"candidate,omitempty"`
+	EndOfCandidates bool                     `json:"end_of_candidates,omitempty"`
+}
+
+type candidateRequest struct {
+	Id              string                   `json:"id"`
+	Session         string                   `json:"session,omitempty"`
+	Candidate       *webrtc.ICECandidateInit `json:"candidate"`
+	EndOfCandidates bool                     `json:"end_of_candidates"`
+}
+
+func (cr *candidateRequest) Validate() (err error) {
+	if cr.Id == "" {
+		err = ErrEmptyID
+		return
+	}
+
+	if cr.Candidate == nil && !cr.EndOfCandidates {
+		err = ErrEmptyCandidate
+		return
+	}
+
+	return
+}
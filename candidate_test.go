@@ -0,0 +1,110 @@
+package webrtcsignalingserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestCandidateHandlers(t *testing.T) {
+	ss := New()
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "candidate", body: `{"id":"publisher","candidate":{"candidate":"candidate:1 1 udp 1 1.2.3.4 5000 typ host"}}`, wantStatus: http.StatusOK},
+		{name: "end_of_candidates", body: `{"id":"publisher","end_of_candidates":true}`, wantStatus: http.StatusOK},
+		{name: "empty_candidate", body: `{"id":"publisher"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown_listener", body: `{"id":"viewer","end_of_candidates":true}`, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ss.candidateHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_candidate", strings.NewReader(tt.body)))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if c := listener.ReadClientCandidate(); c.Candidate == nil || c.Candidate.Candidate != "candidate:1 1 udp 1 1.2.3.4 5000 typ host" {
+		t.Fatalf("ReadClientCandidate() = %+v", c)
+	}
+	if c := listener.ReadClientCandidate(); !c.EndOfCandidates {
+		t.Fatalf("ReadClientCandidate() = %+v, want end of candidates", c)
+	}
+
+	listener.WriteServerCandidate(webrtc.ICECandidateInit{Candidate: "candidate:2 1 udp 1 5.6.7.8 5000 typ host"})
+	listener.WriteServerEndOfCandidates()
+
+	recorder := httptest.NewRecorder()
+	ss.candidatesPollHandler(recorder, httptest.NewRequest(http.MethodGet, "/sdp_candidates?id=publisher", nil))
+
+	var response struct {
+		Data []*Candidate `json:"data"`
+	}
+	if err = json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data) != 2 || response.Data[0].Candidate == nil || !response.Data[1].EndOfCandidates {
+		t.Fatalf("polled candidates = %s", recorder.Body.String())
+	}
+}
+
+func TestListener_CandidateQueues(t *testing.T) {
+	ss := New()
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"id":"publisher","candidate":{"candidate":"candidate:1 1 udp 1 1.2.3.4 5000 typ host"}}`
+	for range maxPendingCandidates {
+		if err = listener.WriteClientCandidate(webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 1 1.2.3.4 5000 typ host"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	ss.candidateHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_candidate", strings.NewReader(body)))
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("status with a full queue = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := listener.ReadServerCandidateContext(t.Context())
+		read <- err
+	}()
+
+	listener.Close(nil)
+
+	select {
+	case err = <-read:
+		if !errors.Is(err, ErrListenerClosed) {
+			t.Errorf("ReadServerCandidateContext() after Close = %v, want %v", err, ErrListenerClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ReadServerCandidateContext() still blocked after Close")
+	}
+
+	// Candidates queued before Close are still read
+	if candidate, err := listener.ReadClientCandidateContext(t.Context()); err != nil || candidate.Candidate == nil {
+		t.Errorf("ReadClientCandidateContext() = %+v, %v", candidate, err)
+	}
+	if err = listener.WriteClientCandidate(webrtc.ICECandidateInit{Candidate: "candidate:2"}); !errors.Is(err, ErrListenerClosed) {
+		t.Errorf("WriteClientCandidate() after Close = %v, want %v", err, ErrListenerClosed)
+	}
+}
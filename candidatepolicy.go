@@ -0,0 +1,256 @@
+package webrtcsignalingserver
+
+import (
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// CandidateFilterReason tells why CandidatePolicy dropped a candidate.
+type CandidateFilterReason string
+
+const (
+	CandidateFilterHost       CandidateFilterReason = "host"
+	CandidateFilterPrivate    CandidateFilterReason = "private"
+	CandidateFilterNotRelay   CandidateFilterReason = "not_relay"
+	CandidateFilterNotAllowed CandidateFilterReason = "not_allowed"
+)
+
+// CandidatePolicy decides which ICE candidates the server passes on, in SDP
+// bodies and trickled alike, so neither side learns addresses it should not.
+type CandidatePolicy struct {
+	// DropHost drops host candidates, the addresses of the machine itself
+	DropHost bool `json:"drop_host"`
+	// DropPrivate drops private, loopback and link-local addresses and mDNS
+	// (.local) names, which stand for such addresses
+	DropPrivate bool `json:"drop_private"`
+	// RelayOnly drops every candidate that is not a TURN relay
+	RelayOnly bool `json:"relay_only"`
+	// AllowCIDRs, when set, drops every address outside of these prefixes
+	AllowCIDRs []netip.Prefix `json:"allow_cidrs,omitempty"`
+}
+
+// Check returns why candidate ("candidate:..." as trickled) is dropped, or
+// false when it is kept. Kept candidates still go through Scrub.
+func (cp *CandidatePolicy) Check(candidate string) (reason CandidateFilterReason, drop bool) {
+	candidateType := CandidateType(candidate)
+	if cp.RelayOnly && candidateType != "relay" {
+		return CandidateFilterNotRelay, true
+	}
+
+	if cp.DropHost && candidateType == "host" {
+		return CandidateFilterHost, true
+	}
+
+	return cp.checkAddress(candidateAddress(candidate))
+}
+
+// checkAddress returns why address is not to be passed on, or false when it
+// may be.
+func (cp *CandidatePolicy) checkAddress(address string) (reason CandidateFilterReason, drop bool) {
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		// An mDNS name or garbage, neither can be checked against a range
+		if cp.DropPrivate && strings.HasSuffix(address, ".local") {
+			return CandidateFilterPrivate, true
+		}
+
+		if len(cp.AllowCIDRs) > 0 {
+			return CandidateFilterNotAllowed, true
+		}
+
+		return
+	}
+
+	ip = ip.Unmap()
+	if cp.DropPrivate && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()) {
+		return CandidateFilterPrivate, true
+	}
+
+	if len(cp.AllowCIDRs) > 0 && !slices.ContainsFunc(cp.AllowCIDRs, func(prefix netip.Prefix) bool { return prefix.Contains(ip) }) {
+		return CandidateFilterNotAllowed, true
+	}
+
+	return
+}
+
+// hides tells whether address, one a candidate was gathered from or the
+// default address of an SDP, gives away what the policy keeps back. Under
+// DropHost and RelayOnly every such address does, they are the local and
+// reflexive addresses themselves.
+func (cp *CandidatePolicy) hides(address string) bool {
+	if cp.DropHost || cp.RelayOnly {
+		return true
+	}
+
+	_, drop := cp.checkAddress(address)
+	return drop
+}
+
+// Scrub zeroes the related address of candidate ("raddr 0.0.0.0 rport 0")
+// when the policy hides it, e.g. the LAN address behind a srflx candidate.
+func (cp *CandidatePolicy) Scrub(candidate string) string {
+	fields := strings.Fields(candidate)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "raddr":
+			if !cp.hides(fields[i+1]) {
+				return candidate
+			}
+			fields[i+1] = unspecifiedAddress(fields[i+1])
+		case "rport":
+			fields[i+1] = "0"
+		}
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// scrubAddress is address, or the unspecified address of its family when the
+// policy hides it.
+func (cp *CandidatePolicy) scrubAddress(address string) string {
+	if !cp.hides(address) {
+		return address
+	}
+	return unspecifiedAddress(address)
+}
+
+func unspecifiedAddress(address string) string {
+	if strings.Contains(address, ":") {
+		return "::"
+	}
+	return "0.0.0.0"
+}
+
+// candidateAddress is the connection address of a candidate, the fifth field
+// after "candidate:".
+func candidateAddress(candidate string) string {
+	fields := strings.Fields(strings.TrimPrefix(candidate, "candidate:"))
+	if len(fields) < 5 {
+		return ""
+	}
+	return fields[4]
+}
+
+// CandidateFilterCount is how many candidates from Origin were dropped for
+// Reason since the server started.
+type CandidateFilterCount struct {
+	Origin SDPOrigin             `json:"origin"`
+	Reason CandidateFilterReason `json:"reason"`
+	Count  uint64                `json:"count"`
+}
+
+type candidateFilterKey struct {
+	origin SDPOrigin
+	reason CandidateFilterReason
+}
+
+type candidateFilterCounts struct {
+	counts map[candidateFilterKey]uint64
+	m      sync.Mutex
+}
+
+// FilteredCandidates counts the candidates the CandidatePolicy dropped, by
+// origin and reason.
+func (ss *SignalingServer) FilteredCandidates() (counts []*CandidateFilterCount) {
+	ss.filteredCandidates.m.Lock()
+	defer ss.filteredCandidates.m.Unlock()
+
+	for key, count := range ss.filteredCandidates.counts {
+		counts = append(counts, &CandidateFilterCount{Origin: key.origin, Reason: key.reason, Count: count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Origin != counts[j].Origin {
+			return counts[i].Origin < counts[j].Origin
+		}
+		return counts[i].Reason < counts[j].Reason
+	})
+	return
+}
+
+// filterCandidate applies the CandidatePolicy to a candidate from origin: it
+// is scrubbed when kept and counted when dropped.
+func (ss *SignalingServer) filterCandidate(origin SDPOrigin, candidate string) (filtered string, keep bool) {
+	if ss.candidatePolicy == nil {
+		return candidate, true
+	}
+
+	reason, drop := ss.candidatePolicy.Check(candidate)
+	if !drop {
+		return ss.candidatePolicy.Scrub(candidate), true
+	}
+
+	ss.filteredCandidates.m.Lock()
+	if ss.filteredCandidates.counts == nil {
+		ss.filteredCandidates.counts = map[candidateFilterKey]uint64{}
+	}
+	ss.filteredCandidates.counts[candidateFilterKey{origin: origin, reason: reason}]++
+	ss.filteredCandidates.m.Unlock()
+
+	return
+}
+
+// filterTrickled is filterCandidate for a trickled candidate, which is
+// copied rather than changed; end-of-candidates markers (nil) are always kept.
+func (ss *SignalingServer) filterTrickled(origin SDPOrigin, candidate *webrtc.ICECandidateInit) (filtered *webrtc.ICECandidateInit, keep bool) {
+	if candidate == nil {
+		return nil, true
+	}
+
+	scrubbed, keep := ss.filterCandidate(origin, candidate.Candidate)
+	if !keep {
+		return
+	}
+
+	copied := *candidate
+	copied.Candidate = scrubbed
+	filtered = &copied
+	return
+}
+
+// candidatePolicyMiddleware applies the CandidatePolicy to SDP bodies: it
+// drops and scrubs candidates and zeroes the c= and a=rtcp addresses the
+// policy hides.
+func (ss *SignalingServer) candidatePolicyMiddleware() SDPMiddleware {
+	return SDPMiddlewareFunc(func(rewrite *SDPRewrite) (err error) {
+		policy := ss.candidatePolicy
+		scrubConnection(policy, rewrite.Description.ConnectionInformation)
+
+		for _, media := range rewrite.Description.MediaDescriptions {
+			scrubConnection(policy, media.ConnectionInformation)
+
+			attributes := media.Attributes[:0]
+			for _, attribute := range media.Attributes {
+				switch attribute.Key {
+				case "candidate":
+					candidate, keep := ss.filterCandidate(rewrite.Origin, "candidate:"+attribute.Value)
+					if !keep {
+						continue
+					}
+					attribute.Value = strings.TrimPrefix(candidate, "candidate:")
+				case "rtcp":
+					// <port> IN IP4 <address>
+					if fields := strings.Fields(attribute.Value); len(fields) == 4 {
+						fields[3] = policy.scrubAddress(fields[3])
+						attribute.Value = strings.Join(fields, " ")
+					}
+				}
+				attributes = append(attributes, attribute)
+			}
+			media.Attributes = attributes
+		}
+		return
+	})
+}
+
+func scrubConnection(policy *CandidatePolicy, connection *sdp.ConnectionInformation) {
+	if connection != nil && connection.Address != nil {
+		connection.Address.Address = policy.scrubAddress(connection.Address.Address)
+	}
+}
@@ -0,0 +1,253 @@
+package webrtcsignalingserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestCandidatePolicy_Check(t *testing.T) {
+	const (
+		host    = "candidate:1 1 udp 2130706431 192.168.1.107 53379 typ host"
+		mdns    = "candidate:1 1 udp 2130706431 4d2f1a3c-8e1b-4c2a-9f0e-1b2c3d4e5f60.local 53379 typ host"
+		srflx   = "candidate:2 1 udp 1694498815 5.121.80.63 64985 typ srflx raddr 0.0.0.0 rport 64731"
+		relay   = "candidate:3 1 udp 41885439 203.0.113.7 3478 typ relay raddr 5.121.80.63 rport 64985"
+		private = "candidate:4 1 udp 1694498815 10.0.0.5 64985 typ srflx raddr 0.0.0.0 rport 64731"
+	)
+
+	tests := []struct {
+		name       string
+		policy     CandidatePolicy
+		candidate  string
+		wantReason CandidateFilterReason
+		wantDrop   bool
+	}{
+		{name: "empty_policy", candidate: host},
+		{name: "drop_host", policy: CandidatePolicy{DropHost: true}, candidate: host, wantReason: CandidateFilterHost, wantDrop: true},
+		{name: "drop_host_keeps_srflx", policy: CandidatePolicy{DropHost: true}, candidate: srflx},
+		{name: "drop_private", policy: CandidatePolicy{DropPrivate: true}, candidate: private, wantReason: CandidateFilterPrivate, wantDrop: true},
+		{name: "drop_private_mdns", policy: CandidatePolicy{DropPrivate: true}, candidate: mdns, wantReason: CandidateFilterPrivate, wantDrop: true},
+		{name: "drop_private_keeps_public", policy: CandidatePolicy{DropPrivate: true}, candidate: srflx},
+		{name: "relay_only", policy: CandidatePolicy{RelayOnly: true}, candidate: srflx, wantReason: CandidateFilterNotRelay, wantDrop: true},
+		{name: "relay_only_keeps_relay", policy: CandidatePolicy{RelayOnly: true}, candidate: relay},
+		{name: "allow_cidrs", policy: CandidatePolicy{AllowCIDRs: []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}}, candidate: srflx, wantReason: CandidateFilterNotAllowed, wantDrop: true},
+		{name: "allow_cidrs_keeps_match", policy: CandidatePolicy{AllowCIDRs: []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}}, candidate: relay},
+		{name: "allow_cidrs_mdns", policy: CandidatePolicy{AllowCIDRs: []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}}, candidate: mdns, wantReason: CandidateFilterNotAllowed, wantDrop: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, drop := tt.policy.Check(tt.candidate)
+			if reason != tt.wantReason || drop != tt.wantDrop {
+				t.Errorf("Check() = %q, %v, want %q, %v", reason, drop, tt.wantReason, tt.wantDrop)
+			}
+		})
+	}
+}
+
+func TestCandidatePolicy_Scrub(t *testing.T) {
+	const (
+		lanSrflx = "candidate:1 1 UDP 1685987327 5.121.80.63 52086 typ srflx raddr 192.168.1.107 rport 52568"
+		wanRelay = "candidate:3 1 udp 41885439 203.0.113.7 3478 typ relay raddr 5.121.80.63 rport 64985"
+	)
+
+	tests := []struct {
+		name      string
+		policy    CandidatePolicy
+		candidate string
+		want      string
+	}{
+		{name: "empty_policy", candidate: lanSrflx, want: lanSrflx},
+		{name: "drop_private", policy: CandidatePolicy{DropPrivate: true}, candidate: lanSrflx, want: "candidate:1 1 UDP 1685987327 5.121.80.63 52086 typ srflx raddr 0.0.0.0 rport 0"},
+		{name: "drop_private_keeps_public_raddr", policy: CandidatePolicy{DropPrivate: true}, candidate: wanRelay, want: wanRelay},
+		{name: "relay_only", policy: CandidatePolicy{RelayOnly: true}, candidate: wanRelay, want: "candidate:3 1 udp 41885439 203.0.113.7 3478 typ relay raddr 0.0.0.0 rport 0"},
+		{name: "no_raddr", policy: CandidatePolicy{DropHost: true}, candidate: "candidate:1 1 udp 2130706431 5.121.80.63 53379 typ host", want: "candidate:1 1 udp 2130706431 5.121.80.63 53379 typ host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Scrub(tt.candidate); got != tt.want {
+				t.Errorf("Scrub() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	ss := New(WithCandidatePolicy(CandidatePolicy{DropPrivate: true}))
+	parsed, err := ParseSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "v=0\r\n" +
+		"o=- 0 0 IN IP4 0.0.0.0\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"a=fingerprint:sha-256 E6:32:0F:C2:21:A8:C1:C7:8C:AA:24:A8:F7:49:D5:3A:22:88:68:58:82:37:EA:C9:B0:33:1E:62:62:5F:0B:FA\r\n" +
+		"m=video 52568 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"c=IN IP4 192.168.1.107\r\n" +
+		"a=ice-ufrag:sMbxeGwbcSAFhgEf\r\n" +
+		"a=ice-pwd:piRMgOyfeyBThjzuaAOxrdUedsOYSmlt\r\n" +
+		"a=mid:0\r\n" +
+		"a=rtpmap:96 VP8/90000\r\n" +
+		"a=rtcp:52570 IN IP4 192.168.1.107\r\n" +
+		"a=candidate:0 1 UDP 2122187007 192.168.1.107 52568 typ host\r\n" +
+		"a=" + lanSrflx + "\r\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrite := &SDPRewrite{Origin: SDPFromClient, Type: webrtc.SDPTypeOffer, Description: parsed}
+	rewritten, err := ss.rewriteSDP(rewrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(rewritten, "192.168.1.107") {
+		t.Errorf("SDP still carries the LAN address:\n%s", rewritten)
+	}
+	if !strings.Contains(rewritten, "typ srflx raddr 0.0.0.0 rport 0") || !strings.Contains(rewritten, "c=IN IP4 0.0.0.0") || !strings.Contains(rewritten, "a=rtcp:52570 IN IP4 0.0.0.0") {
+		t.Errorf("SDP was not scrubbed:\n%s", rewritten)
+	}
+}
+
+func TestSignalingServer_CandidatePolicy(t *testing.T) {
+	ss := New(WithCandidatePolicy(CandidatePolicy{DropHost: true}))
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"id":"publisher","candidate":{"candidate":"candidate:1 1 udp 2130706431 192.168.1.107 53379 typ host"}}`
+	recorder := httptest.NewRecorder()
+	ss.candidateHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_candidate", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("host candidate = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	body = `{"id":"publisher","candidate":{"candidate":"candidate:2 1 udp 1694498815 5.121.80.63 64985 typ srflx raddr 0.0.0.0 rport 64731"}}`
+	recorder = httptest.NewRecorder()
+	ss.candidateHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_candidate", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("srflx candidate = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if candidate := listener.ReadClientCandidate(); !strings.Contains(candidate.Candidate.Candidate, "typ srflx") {
+		t.Errorf("ReadClientCandidate() = %s, want the srflx candidate", candidate.Candidate.Candidate)
+	}
+
+	listener.WriteServerCandidate(webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 10.0.0.5 53379 typ host"})
+	recorder = httptest.NewRecorder()
+	ss.candidatesPollHandler(recorder, httptest.NewRequest(http.MethodGet, "/sdp_candidates?id=publisher", nil))
+	if strings.Contains(recorder.Body.String(), "typ host") {
+		t.Errorf("polled candidates = %s, want no host candidate", recorder.Body.String())
+	}
+
+	go func() {
+		clientSDP, err := listener.ReadSDPClientContext(t.Context())
+		if err != nil {
+			return
+		}
+
+		if strings.Contains(clientSDP.SDP().SDP, "typ host") || !strings.Contains(clientSDP.SDP().SDP, "typ srflx") {
+			t.Errorf("delivered SDP was not filtered:\n%s", clientSDP.SDP().SDP)
+		}
+
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testVideoOfferSDP}, nil)
+	}()
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testVideoOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder = httptest.NewRecorder()
+	body = `{"id":"publisher","sdp":"` + offer + `"}`
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("handshake = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response struct {
+		Data *SDPServer `json:"data"`
+	}
+	if err = json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := DecodeBase64StringToWebrtcSDP(response.Data.SDPBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(answer.SDP, "typ host") {
+		t.Errorf("answer was not filtered:\n%s", answer.SDP)
+	}
+
+	want := []CandidateFilterCount{
+		{Origin: SDPFromClient, Reason: CandidateFilterHost, Count: 2},
+		{Origin: SDPFromServer, Reason: CandidateFilterHost, Count: 2},
+	}
+	counts := ss.FilteredCandidates()
+	if len(counts) != len(want) {
+		t.Fatalf("FilteredCandidates() = %d counts, want %d", len(counts), len(want))
+	}
+	for i := range want {
+		if *counts[i] != want[i] {
+			t.Errorf("FilteredCandidates()[%d] = %+v, want %+v", i, *counts[i], want[i])
+		}
+	}
+}
+
+func TestSignalingServer_CandidatePolicyStoreAndRooms(t *testing.T) {
+	ss := New(WithCandidatePolicy(CandidatePolicy{DropHost: true}))
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testVideoOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	ss.sdpStoreHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_store", strings.NewReader(`{"id":"stored","sdp":"`+offer+`"}`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("store = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	ss.sdpFetchHandler(recorder, httptest.NewRequest(http.MethodGet, "/sdp_fetch?id=stored", nil))
+
+	var fetched struct {
+		Data *sdpFetchResponse `json:"data"`
+	}
+	if err = json.Unmarshal(recorder.Body.Bytes(), &fetched); err != nil {
+		t.Fatal(err)
+	}
+	if sdp, err := DecodeBase64StringToWebrtcSDP(fetched.Data.SDP); err != nil || strings.Contains(sdp.SDP, "typ host") {
+		t.Errorf("fetched SDP was not filtered: %v\n%v", err, sdp)
+	}
+
+	alice, err := ss.JoinRoom("call", "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := ss.JoinRoom("call", "bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.Pending() // bob's join
+
+	if err = bob.SendSDP("alice", &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testVideoOfferSDP}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = bob.SendCandidate("alice", webrtc.ICECandidateInit{Candidate: "candidate:1 1 udp 2130706431 192.168.1.107 53379 typ host"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = bob.SendEndOfCandidates("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := alice.Pending()
+	if len(messages) != 2 || messages[0].Type != RoomMessageOffer || messages[1].Type != RoomMessageEndOfCandidates {
+		t.Fatalf("alice got %+v, want the offer and end_of_candidates", messages)
+	}
+	if sdp, err := DecodeBase64StringToWebrtcSDP(messages[0].SDP); err != nil || strings.Contains(sdp.SDP, "typ host") {
+		t.Errorf("relayed SDP was not filtered: %v\n%v", err, sdp)
+	}
+}
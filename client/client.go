@@ -0,0 +1,323 @@
+// Package client calls the HTTP endpoints of a signaling server from Go:
+// /sdp_handshake, /sdp_inform, /sdp_store and /sdp_fetch. SDPs go in and come
+// out as webrtc.SessionDescription, the BASE64 encoding is done here.
+//
+// Error responses are decoded into the Err... values of the server package,
+// so errors.Is(err, webrtcsignalingserver.ErrListenerNotFound) works on the
+// errors of a Client.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = 200 * time.Millisecond
+	DefaultMaxBackoff  = 5 * time.Second
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+type Option func(c *Client)
+
+// WithHTTPClient sends requests with httpClient instead of
+// http.DefaultClient, e.g. for timeouts, TLS or tracing transports.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithBearerToken sends token as "Authorization: Bearer <token>", see
+// webrtcsignalingserver.BearerAuthenticator and JWTAuthenticator.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries makes up to maxAttempts attempts at a call that may be retried,
+// waiting backoff after the first failure and doubling up to maxBackoff.
+// One attempt disables retries.
+func WithRetries(maxAttempts int, backoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxAttempts, c.backoff, c.maxBackoff = maxAttempts, backoff, maxBackoff
+	}
+}
+
+// New calls the signaling server at baseURL, e.g. "https://signaling.example".
+func New(baseURL string, options ...Option) (c *Client) {
+	c = &Client{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		httpClient:  http.DefaultClient,
+		maxAttempts: DefaultMaxAttempts,
+		backoff:     DefaultBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.maxAttempts < 1 {
+		c.maxAttempts = 1
+	}
+
+	return
+}
+
+type sdpRequest struct {
+	Id   string            `json:"id"`
+	SDP  string            `json:"sdp"` // BASE64
+	Data map[string]string `json:"data,omitempty"`
+	TTL  int               `json:"ttl,omitempty"`
+}
+
+type sdpResponse struct {
+	SDP  string            `json:"sdp"` // BASE64
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// Handshake sends offer to the listener of id and waits for its answer.
+func (c *Client) Handshake(ctx context.Context, id string, offer *webrtc.SessionDescription, data map[string]string) (answer *webrtc.SessionDescription, answerData map[string]string, err error) {
+	var response *sdpResponse
+	err = c.post(ctx, "/sdp_handshake", id, offer, data, 0, &response)
+	if err != nil {
+		return
+	}
+
+	return decodeSDP(response)
+}
+
+// Inform delivers sdp, an offer or an answer, to the listener of id without
+// waiting for an answer.
+func (c *Client) Inform(ctx context.Context, id string, sdp *webrtc.SessionDescription, data map[string]string) (err error) {
+	err = c.post(ctx, "/sdp_inform", id, sdp, data, 0, nil)
+	return
+}
+
+// Store keeps sdp under id for ttl, rounded up to seconds. Zero leaves the
+// ttl to the server.
+func (c *Client) Store(ctx context.Context, id string, sdp *webrtc.SessionDescription, data map[string]string, ttl time.Duration) (err error) {
+	seconds := int((ttl + time.Second - 1) / time.Second)
+	err = c.post(ctx, "/sdp_store", id, sdp, data, seconds, nil)
+	return
+}
+
+// Fetch returns the SDP stored under id and leaves it stored.
+func (c *Client) Fetch(ctx context.Context, id string) (sdp *webrtc.SessionDescription, data map[string]string, err error) {
+	return c.fetch(ctx, id, false)
+}
+
+// Consume returns the SDP stored under id and removes it, so it is not
+// retried like Fetch.
+func (c *Client) Consume(ctx context.Context, id string) (sdp *webrtc.SessionDescription, data map[string]string, err error) {
+	return c.fetch(ctx, id, true)
+}
+
+func (c *Client) fetch(ctx context.Context, id string, consume bool) (sdp *webrtc.SessionDescription, data map[string]string, err error) {
+	query := url.Values{"id": {id}}
+	if consume {
+		query.Set("consume", "true")
+	}
+
+	var response *sdpResponse
+	err = c.do(ctx, http.MethodGet, "/sdp_fetch?"+query.Encode(), nil, !consume, &response)
+	if err != nil {
+		return
+	}
+
+	return decodeSDP(response)
+}
+
+func (c *Client) post(ctx context.Context, path, id string, sdp *webrtc.SessionDescription, data map[string]string, ttl int, result interface{}) (err error) {
+	encoded, err := webrtcsignalingserver.EncodeWebrtcSdpToBase64(sdp)
+	if err != nil {
+		return
+	}
+
+	body, err := json.Marshal(&sdpRequest{Id: id, SDP: encoded, Data: data, TTL: ttl})
+	if err != nil {
+		return
+	}
+
+	// Handshakes, informs and stores are used up on the server, they are only
+	// retried when refused before anything happened
+	err = c.do(ctx, http.MethodPost, path, body, false, result)
+	return
+}
+
+// do makes attempts at a request until one succeeds or may not be retried.
+// Idempotent requests are retried on network errors, 408, 429 and 5xx; every
+// request is retried when the server refused it without acting on it. A
+// Retry-After header, capped at maxBackoff, replaces the backoff.
+func (c *Client) do(ctx context.Context, method, path string, body []byte, idempotent bool, result interface{}) (err error) {
+	backoff := c.backoff
+
+	for attempt := 1; ; attempt++ {
+		var (
+			retry      bool
+			retryAfter time.Duration
+		)
+
+		retry, retryAfter, err = c.attempt(ctx, method, path, body, idempotent, result)
+		if err == nil || !retry || attempt >= c.maxAttempts || ctx.Err() != nil {
+			return
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = min(retryAfter, c.maxBackoff)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff = min(backoff*2, c.maxBackoff)
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, idempotent bool, result interface{}) (retry bool, retryAfter time.Duration, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return
+	}
+
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if requestID := webrtcsignalingserver.RequestIDFromContext(ctx); requestID != "" {
+		request.Header.Set(webrtcsignalingserver.RequestIDHeader, requestID)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		retry = idempotent
+		return
+	}
+	defer response.Body.Close()
+
+	payload, err := io.ReadAll(response.Body)
+	if err != nil {
+		retry = idempotent
+		return
+	}
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		err = decodeData(payload, result)
+		return
+	}
+
+	err = responseError(response.StatusCode, payload)
+
+	seconds, _ := strconv.Atoi(response.Header.Get("Retry-After"))
+	retryAfter = time.Duration(seconds) * time.Second
+
+	retry = refused(err) || idempotent && (response.StatusCode >= http.StatusInternalServerError ||
+		response.StatusCode == http.StatusRequestTimeout ||
+		response.StatusCode == http.StatusTooManyRequests)
+	return
+}
+
+// refused tells whether the server turned the request away before acting on
+// it, so even a request that is used up can be sent again.
+func refused(err error) bool {
+	return errors.Is(err, webrtcsignalingserver.ErrRateLimited) ||
+		errors.Is(err, webrtcsignalingserver.ErrTooManyPendingHandshakes) ||
+		errors.Is(err, webrtcsignalingserver.ErrServerShutdown)
+}
+
+// decodeData decodes the data of a successful response into result, when
+// there is one.
+func decodeData(payload []byte, result interface{}) (err error) {
+	if result == nil {
+		return
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	err = json.Unmarshal(payload, &envelope)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(envelope.Data, result)
+	return
+}
+
+// responseError turns an error response back into the Err... value of its
+// code, keeping the detail. Responses without a known code, e.g. from a
+// proxy, are errors of their status.
+func responseError(status int, payload []byte) error {
+	var envelope *webrtcsignalingserver.ErrorEnvelope
+	if json.Unmarshal(payload, &envelope) != nil || envelope == nil || envelope.Error == nil {
+		return fmt.Errorf("client: unexpected response %d %s", status, http.StatusText(status))
+	}
+
+	e, ok := webrtcsignalingserver.ErrorForCode(envelope.Error.Code)
+	if !ok {
+		return fmt.Errorf("client: unexpected response %d %s: %s", status, envelope.Error.Code, envelope.Error.Message)
+	}
+
+	detail := envelope.Error.Detail
+	if detail == "" {
+		return e
+	}
+
+	// The detail is the text of the error on the server, which mostly starts with its code
+	if rest, found := strings.CutPrefix(detail, string(e.Code())); found {
+		return fmt.Errorf("%w%s", e, rest)
+	}
+
+	return fmt.Errorf("%w: %s", e, detail)
+}
+
+func decodeSDP(response *sdpResponse) (sdp *webrtc.SessionDescription, data map[string]string, err error) {
+	if response == nil {
+		err = webrtcsignalingserver.ErrInvalidSDP
+		return
+	}
+
+	sdp, err = webrtcsignalingserver.DecodeBase64StringToWebrtcSDP(response.SDP)
+	if err != nil {
+		return
+	}
+
+	data = response.Data
+	return
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/pion/webrtc/v3"
+)
+
+const testSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=fingerprint:sha-256 E6:32:0F:C2:21:A8:C1:C7:8C:AA:24:A8:F7:49:D5:3A:22:88:68:58:82:37:EA:C9:B0:33:1E:62:62:5F:0B:FA\r\n" +
+	"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=ice-ufrag:sMbxeGwbcSAFhgEf\r\n" +
+	"a=ice-pwd:piRMgOyfeyBThjzuaAOxrdUedsOYSmlt\r\n" +
+	"a=mid:0\r\n" +
+	"a=sctp-port:5000\r\n"
+
+func TestClient(t *testing.T) {
+	ss := webrtcsignalingserver.New(webrtcsignalingserver.WithAuthenticator(
+		webrtcsignalingserver.NewBearerAuthenticator(map[string]string{"secret": "backend"}),
+	))
+
+	server := httptest.NewServer(ss.Handler())
+	defer server.Close()
+
+	c := New(server.URL+"/", WithBearerToken("secret"), WithHTTPClient(server.Client()))
+	offer := &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testSDP}
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		clientSDP, err := listener.ReadSDPClientContext(t.Context())
+		if err != nil || clientSDP.Data()["role"] != "viewer" {
+			t.Errorf("client SDP = %v, %v", clientSDP, err)
+			return
+		}
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testSDP}, map[string]string{"server": "sfu-1"})
+	}()
+
+	answer, answerData, err := c.Handshake(t.Context(), "publisher", offer, map[string]string{"role": "viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Type != webrtc.SDPTypeAnswer || answer.SDP != testSDP || answerData["server"] != "sfu-1" {
+		t.Errorf("Handshake() = %v, %v", answer, answerData)
+	}
+
+	if err = c.Inform(t.Context(), "nobody", offer, nil); !errors.Is(err, webrtcsignalingserver.ErrListenerNotFound) {
+		t.Errorf("Inform() to a missing listener = %v", err)
+	}
+
+	if err = c.Store(t.Context(), "stored", offer, map[string]string{"room": "lobby"}, 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Store(t.Context(), "stored", offer, nil, 0); !errors.Is(err, webrtcsignalingserver.ErrSDPExists) {
+		t.Errorf("Store() twice = %v", err)
+	}
+
+	sdp, data, err := c.Fetch(t.Context(), "stored")
+	if err != nil || sdp.SDP != testSDP || data["room"] != "lobby" {
+		t.Fatalf("Fetch() = %v, %v, %v", sdp, data, err)
+	}
+	if _, _, err = c.Consume(t.Context(), "stored"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = c.Fetch(t.Context(), "stored"); !errors.Is(err, webrtcsignalingserver.ErrSDPNotFound) {
+		t.Errorf("Fetch() after Consume() = %v", err)
+	}
+
+	_, _, err = New(server.URL).Fetch(t.Context(), "stored")
+	if !errors.Is(err, webrtcsignalingserver.ErrMissingCredentials) {
+		t.Errorf("Fetch() without a token = %v", err)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	storage := webrtcsignalingserver.NewMemoryStorage(0)
+	if err := storage.AddSDPToStorage("stored", mustEncode(t), nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	handler := webrtcsignalingserver.New(webrtcsignalingserver.WithStorage(storage)).Handler()
+
+	// Fails the first two requests to every path
+	attempts := map[string]*atomic.Int32{"/sdp_fetch": {}, "/sdp_store": {}, "/sdp_handshake": {}}
+	flaky := func(status int, code string) http.HandlerFunc {
+		return func(writer http.ResponseWriter, request *http.Request) {
+			if attempts[request.URL.Path].Add(1) <= 2 {
+				writer.Header().Set("Retry-After", "60")
+				writer.WriteHeader(status)
+				if code == "" {
+					writer.Write([]byte("proxy error"))
+					return
+				}
+				writer.Write([]byte(`{"status_code":` + strconv.Itoa(status) + `,"data":"` + code + `","error":{"code":"` + code + `","message":"flaky"}}`))
+				return
+			}
+			handler.ServeHTTP(writer, request)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/sdp_fetch", flaky(http.StatusBadGateway, ""))
+	mux.Handle("/sdp_store", flaky(http.StatusInternalServerError, "internal_error"))
+	mux.Handle("/sdp_handshake", flaky(http.StatusTooManyRequests, "rate_limited"))
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := New(server.URL, WithRetries(3, time.Millisecond, 5*time.Millisecond))
+	offer := &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testSDP}
+
+	started := time.Now()
+	if _, _, err := c.Fetch(t.Context(), "stored"); err != nil {
+		t.Errorf("Fetch() after two failures = %v", err)
+	}
+	if waited := time.Since(started); waited > time.Second {
+		t.Errorf("Retry-After was not capped, waited %s", waited)
+	}
+
+	// Stores are not idempotent, a failure is returned at once
+	if err := c.Store(t.Context(), "other", offer, nil, 0); !errors.Is(err, webrtcsignalingserver.ErrInternal) {
+		t.Errorf("Store() = %v", err)
+	}
+	if got := attempts["/sdp_store"].Load(); got != 1 {
+		t.Errorf("Store() made %d attempts, want 1", got)
+	}
+
+	// Rate limited requests never reached a listener, so handshakes are retried
+	_, _, err := c.Handshake(t.Context(), "publisher", offer, nil)
+	if !errors.Is(err, webrtcsignalingserver.ErrListenerNotFound) {
+		t.Errorf("Handshake() = %v", err)
+	}
+	if got := attempts["/sdp_handshake"].Load(); got != 3 {
+		t.Errorf("Handshake() made %d attempts, want 3", got)
+	}
+
+	if !strings.Contains(New(server.URL, WithRetries(1, 0, 0)).Inform(t.Context(), "publisher", offer, nil).Error(), "404") {
+		t.Error("Inform() to an unknown path did not report the status")
+	}
+}
+
+func mustEncode(t *testing.T) string {
+	offer, err := webrtcsignalingserver.EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offer
+}
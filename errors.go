@@ -0,0 +1,286 @@
+package webrtcsignalingserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorCode is the stable, machine readable name of an error. It is the data
+// of every error response and the text of the matching Err... value.
+type ErrorCode string
+
+const (
+	CodeInvalidJSON              ErrorCode = "invalid_json"
+	CodeEmptyID                  ErrorCode = "empty_id"
+	CodeInvalidTTL               ErrorCode = "invalid_ttl"
+	CodeInvalidSDP               ErrorCode = "invalid_sdp"
+	CodeSDPTypeMismatch          ErrorCode = "sdp_type_mismatch"
+	CodeSDPNoMedia               ErrorCode = "sdp_no_media"
+	CodeSDPMissingICECredentials ErrorCode = "sdp_missing_ice_credentials"
+	CodeSDPMissingFingerprint    ErrorCode = "sdp_missing_fingerprint"
+	CodeSDPRejected              ErrorCode = "sdp_rejected"
+	CodeEmptyCandidate           ErrorCode = "empty_candidate"
+	CodeEmptyMessage             ErrorCode = "empty_message"
+	CodeEmptyTo                  ErrorCode = "empty_to"
+	CodeEmptyToken               ErrorCode = "empty_token"
+	CodeInvalidMessageType       ErrorCode = "invalid_message_type"
+	CodeUnknownFrameType         ErrorCode = "unknown_frame_type"
+	CodeWebsocketUpgradeRequired ErrorCode = "websocket_upgrade_required"
+	CodeMethodNotAllowed         ErrorCode = "method_not_allowed"
+	CodeRequestTooLarge          ErrorCode = "request_too_large"
+	CodeUnsupportedSnapshot      ErrorCode = "unsupported_snapshot_version"
+
+	CodeUnauthorized       ErrorCode = "unauthorized"
+	CodeMissingCredentials ErrorCode = "missing_credentials"
+	CodeInvalidCredentials ErrorCode = "invalid_credentials"
+	CodeInvalidSignature   ErrorCode = "invalid_signature"
+	CodeSignatureExpired   ErrorCode = "signature_expired"
+	CodeInvalidToken       ErrorCode = "invalid_token"
+	CodeTokenExpired       ErrorCode = "token_expired"
+	CodeInvalidRole        ErrorCode = "invalid_role"
+
+	CodeForbidden              ErrorCode = "forbidden"
+	CodeTokenNotValidForID     ErrorCode = "token_not_valid_for_id"
+	CodeSignatureNotValidForID ErrorCode = "signature_not_valid_for_id"
+	CodeRoleNotAllowed         ErrorCode = "role_not_allowed"
+
+	CodeListenerNotFound  ErrorCode = "listener_does_not_exist"
+	CodeSessionNotFound   ErrorCode = "session_does_not_exist"
+	CodeSDPNotFound       ErrorCode = "sdp_does_not_exists"
+	CodeRoomNotFound      ErrorCode = "room_does_not_exist"
+	CodePeerNotFound      ErrorCode = "peer_does_not_exist"
+	CodeRecipientNotFound ErrorCode = "recipient_does_not_exist"
+
+	CodeListenerExists ErrorCode = "listener_exists"
+	CodeSDPExists      ErrorCode = "sdp_exists"
+	CodePeerExists     ErrorCode = "peer_exists"
+
+	CodeListenerClosed     ErrorCode = "listener_closed"
+	CodePeerLeft           ErrorCode = "peer_left"
+	CodeClientDisconnected ErrorCode = "client_disconnected"
+
+	CodeRateLimited              ErrorCode = "rate_limited"
+	CodeTooManyPendingHandshakes ErrorCode = "too_many_pending_handshakes"
+	CodeStorageFull              ErrorCode = "storage_full"
+	CodeRecipientInboxFull       ErrorCode = "recipient_inbox_full"
+	CodeTooManyCandidates        ErrorCode = "too_many_candidates"
+
+	CodeInternal         ErrorCode = "internal_error"
+	CodeStorageClosed    ErrorCode = "storage_closed"
+	CodeServerShutdown   ErrorCode = "server_shutdown"
+	CodeHandshakeTimeout ErrorCode = "handshake_timeout"
+)
+
+// Error is an error with a code and the HTTP status it is answered with.
+// Compare against the Err... values with errors.Is; errors wrapping one with
+// more detail match it too.
+type Error struct {
+	code    ErrorCode
+	status  int
+	message string
+}
+
+func newError(code ErrorCode, status int, message string) *Error {
+	e := &Error{code: code, status: status, message: message}
+	errorsByCode[code] = e
+	return e
+}
+
+var errorsByCode = map[ErrorCode]*Error{}
+
+var (
+	ErrInvalidJSON              = newError(CodeInvalidJSON, http.StatusBadRequest, "The request body is not valid JSON")
+	ErrEmptyID                  = newError(CodeEmptyID, http.StatusBadRequest, "The request names no id")
+	ErrInvalidTTL               = newError(CodeInvalidTTL, http.StatusBadRequest, "The ttl is negative")
+	ErrInvalidSDP               = newError(CodeInvalidSDP, http.StatusBadRequest, "The SDP is not a valid base64 encoded session description")
+	ErrSDPTypeMismatch          = newError(CodeSDPTypeMismatch, http.StatusBadRequest, "The SDP type does not fit the request")
+	ErrSDPNoMedia               = newError(CodeSDPNoMedia, http.StatusBadRequest, "The SDP has no media section")
+	ErrSDPMissingICECredentials = newError(CodeSDPMissingICECredentials, http.StatusBadRequest, "The SDP lacks ice-ufrag or ice-pwd")
+	ErrSDPMissingFingerprint    = newError(CodeSDPMissingFingerprint, http.StatusBadRequest, "The SDP lacks a DTLS fingerprint")
+	ErrSDPRejected              = newError(CodeSDPRejected, http.StatusBadRequest, "An SDP middleware rejected the SDP")
+	ErrEmptyCandidate           = newError(CodeEmptyCandidate, http.StatusBadRequest, "The request carries neither a candidate nor end_of_candidates")
+	ErrEmptyMessage             = newError(CodeEmptyMessage, http.StatusBadRequest, "The request carries no message")
+	ErrEmptyTo                  = newError(CodeEmptyTo, http.StatusBadRequest, "The message names no recipient")
+	ErrEmptyToken               = newError(CodeEmptyToken, http.StatusBadRequest, "The request carries no room token")
+	ErrInvalidMessageType       = newError(CodeInvalidMessageType, http.StatusBadRequest, "The message type is unknown")
+	ErrUnknownFrameType         = newError(CodeUnknownFrameType, http.StatusBadRequest, "The websocket frame type is unknown")
+	ErrWebsocketUpgradeRequired = newError(CodeWebsocketUpgradeRequired, http.StatusBadRequest, "The endpoint only accepts websocket upgrades")
+	ErrMethodNotAllowed         = newError(CodeMethodNotAllowed, http.StatusMethodNotAllowed, "The endpoint does not accept this method")
+	ErrRequestTooLarge          = newError(CodeRequestTooLarge, http.StatusRequestEntityTooLarge, "The request body is too large")
+	ErrUnsupportedSnapshot      = newError(CodeUnsupportedSnapshot, http.StatusBadRequest, "The snapshot version is not supported")
+
+	ErrUnauthorized       = newError(CodeUnauthorized, http.StatusUnauthorized, "The request was not authenticated")
+	ErrMissingCredentials = newError(CodeMissingCredentials, http.StatusUnauthorized, "The request carries no credentials")
+	ErrInvalidCredentials = newError(CodeInvalidCredentials, http.StatusUnauthorized, "The credentials are not known")
+	ErrInvalidSignature   = newError(CodeInvalidSignature, http.StatusUnauthorized, "The URL signature does not match")
+	ErrSignatureExpired   = newError(CodeSignatureExpired, http.StatusUnauthorized, "The signed URL expired")
+	ErrInvalidToken       = newError(CodeInvalidToken, http.StatusUnauthorized, "The token is not valid")
+	ErrTokenExpired       = newError(CodeTokenExpired, http.StatusUnauthorized, "The token expired")
+	ErrInvalidRole        = newError(CodeInvalidRole, http.StatusUnauthorized, "The token carries an unknown role")
+
+	ErrForbidden              = newError(CodeForbidden, http.StatusForbidden, "The principal may not do this")
+	ErrTokenNotValidForID     = newError(CodeTokenNotValidForID, http.StatusForbidden, "The token is not valid for this id")
+	ErrSignatureNotValidForID = newError(CodeSignatureNotValidForID, http.StatusForbidden, "The URL was not signed for this id")
+	ErrRoleNotAllowed         = newError(CodeRoleNotAllowed, http.StatusForbidden, "The role of the token does not allow this")
+
+	ErrListenerNotFound  = newError(CodeListenerNotFound, http.StatusNotFound, "No listener is registered for this id")
+	ErrSessionNotFound   = newError(CodeSessionNotFound, http.StatusNotFound, "The listener has no such session")
+	ErrSDPNotFound       = newError(CodeSDPNotFound, http.StatusNotFound, "No SDP is stored for this id")
+	ErrRoomNotFound      = newError(CodeRoomNotFound, http.StatusNotFound, "The room does not exist")
+	ErrPeerNotFound      = newError(CodePeerNotFound, http.StatusNotFound, "The peer is not in the room or the token is wrong")
+	ErrRecipientNotFound = newError(CodeRecipientNotFound, http.StatusNotFound, "The recipient is not in the room")
+
+	ErrListenerExists = newError(CodeListenerExists, http.StatusConflict, "A listener is already registered for this id")
+	ErrSDPExists      = newError(CodeSDPExists, http.StatusConflict, "An SDP is already stored for this id")
+	ErrPeerExists     = newError(CodePeerExists, http.StatusConflict, "The peer id is taken in this room")
+
+	ErrListenerClosed     = newError(CodeListenerClosed, http.StatusGone, "The listener was closed")
+	ErrPeerLeft           = newError(CodePeerLeft, http.StatusGone, "The peer left the room")
+	ErrClientDisconnected = newError(CodeClientDisconnected, http.StatusGone, "The websocket of the client disconnected")
+
+	ErrRateLimited              = newError(CodeRateLimited, http.StatusTooManyRequests, "Too many requests, retry after the Retry-After header")
+	ErrTooManyPendingHandshakes = newError(CodeTooManyPendingHandshakes, http.StatusTooManyRequests, "Too many handshakes are pending")
+	ErrStorageFull              = newError(CodeStorageFull, http.StatusTooManyRequests, "Storage holds the most SDPs allowed")
+	ErrRecipientInboxFull       = newError(CodeRecipientInboxFull, http.StatusTooManyRequests, "The recipient has too many messages it did not read")
+	ErrTooManyCandidates        = newError(CodeTooManyCandidates, http.StatusTooManyRequests, "The listener has too many candidates nobody read")
+
+	ErrInternal         = newError(CodeInternal, http.StatusInternalServerError, "The server failed to handle the request")
+	ErrStorageClosed    = newError(CodeStorageClosed, http.StatusServiceUnavailable, "Storage is closed")
+	ErrServerShutdown   = newError(CodeServerShutdown, http.StatusServiceUnavailable, "The server is shutting down")
+	ErrHandshakeTimeout = newError(CodeHandshakeTimeout, http.StatusGatewayTimeout, "The listener did not answer in time")
+)
+
+// Error returns the code, so the text of an error stays what it always was.
+func (e *Error) Error() string {
+	return string(e.code)
+}
+
+func (e *Error) Code() ErrorCode {
+	return e.code
+}
+
+// Status is the HTTP status the error is answered with.
+func (e *Error) Status() int {
+	return e.status
+}
+
+// Message describes the error for humans.
+func (e *Error) Message() string {
+	return e.message
+}
+
+// ErrorForCode finds the Err... value of code, e.g. to turn the code of an
+// error response back into an error errors.Is recognizes.
+func ErrorForCode(code ErrorCode) (e *Error, ok bool) {
+	e, ok = errorsByCode[code]
+	return
+}
+
+// wrapError makes err match e with errors.Is, keeping its text as detail.
+func wrapError(e *Error, err error) error {
+	return fmt.Errorf("%w: %v", e, err)
+}
+
+// publicText is the text of err a client may see: the text of Errors, the
+// code of ErrInternal for anything else.
+func publicText(err error) string {
+	var e *Error
+	if !errors.As(err, &e) {
+		return string(CodeInternal)
+	}
+
+	return err.Error()
+}
+
+// asError keeps err if it is an Error and wraps it into fallback otherwise,
+// e.g. for errors of an Authenticator.
+func asError(err error, fallback *Error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	return wrapError(fallback, err)
+}
+
+// ErrorEnvelope is the data of every error response:
+//
+//	{"status_code": 404, "status_name": "NOT_FOUND", "data": "listener_does_not_exist",
+//	 "error": {"code": "listener_does_not_exist", "message": "...", "detail": "..."}}
+//
+// data holds the code as before, error describes it.
+type ErrorEnvelope struct {
+	StatusCode int        `json:"status_code"`
+	StatusName string     `json:"status_name"`
+	Data       ErrorCode  `json:"data"`
+	Error      *ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Detail is set when the error says more than its code
+	Detail string `json:"detail,omitempty"`
+}
+
+// writeError answers with the envelope of err. Errors that are no Error are
+// answered as ErrInternal without detail; correlate logs what they were.
+func writeError(writer http.ResponseWriter, err error) {
+	var e *Error
+	body := &ErrorBody{}
+
+	if errors.As(err, &e) {
+		if text := err.Error(); text != string(e.code) {
+			body.Detail = text
+		}
+	} else {
+		e = ErrInternal
+	}
+	body.Code, body.Message = e.code, e.message
+
+	payload, _ := json.Marshal(&ErrorEnvelope{
+		StatusCode: e.status,
+		StatusName: statusName(e.status),
+		Data:       e.code,
+		Error:      body,
+	})
+
+	recordError(writer, err)
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(e.status)
+	writer.Write(payload)
+}
+
+// statusName names status the way httpjson does, e.g. "NOT_FOUND".
+func statusName(status int) string {
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// maxRequestSize bounds the JSON body of a request, SDPs included.
+const maxRequestSize = 1 << 20
+
+// parseRequest decodes the JSON body of request into destination, answering
+// with ErrInvalidJSON or ErrRequestTooLarge and returning false when it is not
+// valid.
+func parseRequest(writer http.ResponseWriter, request *http.Request, destination interface{}) bool {
+	request.Body = http.MaxBytesReader(writer, request.Body, maxRequestSize)
+	defer request.Body.Close()
+
+	err := json.NewDecoder(request.Body).Decode(destination)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(writer, ErrRequestTooLarge)
+			return false
+		}
+
+		writeError(writer, wrapError(ErrInvalidJSON, err))
+		return false
+	}
+
+	return true
+}
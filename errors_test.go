@@ -0,0 +1,112 @@
+package webrtcsignalingserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignalingServer_ErrorEnvelope(t *testing.T) {
+	ss := New()
+	if _, err := ss.AddSDPListener("publisher"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{name: "invalid_json", body: `{`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidJSON},
+		{name: "empty_id", body: `{"sdp":"x"}`, wantStatus: http.StatusBadRequest, wantCode: CodeEmptyID},
+		{name: "unknown_listener", body: `{"id":"viewer","sdp":"` + testOfferBase64(t) + `"}`, wantStatus: http.StatusNotFound, wantCode: CodeListenerNotFound},
+		{name: "invalid_base64", body: `{"id":"publisher","sdp":"%%%"}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidSDP},
+		{name: "too_large", body: `{"id":"publisher","sdp":"` + strings.Repeat("A", maxRequestSize) + `"}`, wantStatus: http.StatusRequestEntityTooLarge, wantCode: CodeRequestTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ss.sdpInformListenerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_inform", strings.NewReader(tt.body)))
+
+			var envelope ErrorEnvelope
+			if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+				t.Fatal(err)
+			}
+
+			if recorder.Code != tt.wantStatus || envelope.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d (%d in the body), want %d", recorder.Code, envelope.StatusCode, tt.wantStatus)
+			}
+
+			if envelope.Data != tt.wantCode || envelope.Error == nil || envelope.Error.Code != tt.wantCode || envelope.Error.Message == "" {
+				t.Errorf("envelope = %s, want code %s", recorder.Body.String(), tt.wantCode)
+			}
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	ss.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sdp_fetch?id=stored", nil))
+	if recorder.Code != http.StatusMethodNotAllowed || !strings.Contains(recorder.Body.String(), `"status_name":"METHOD_NOT_ALLOWED"`) {
+		t.Errorf("fetch with POST = %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestError_Is(t *testing.T) {
+	_, err := NewClientSDP("%%%", nil)
+	if !errors.Is(err, ErrInvalidSDP) {
+		t.Errorf("NewClientSDP() error = %v, want it to match %v", err, ErrInvalidSDP)
+	}
+
+	var e *Error
+	if !errors.As(err, &e) || e.Status() != http.StatusBadRequest {
+		t.Errorf("NewClientSDP() error = %v, want a 400 Error", err)
+	}
+
+	if found, ok := ErrorForCode(CodeSDPExists); !ok || found != ErrSDPExists {
+		t.Errorf("ErrorForCode(%s) = %v, %v", CodeSDPExists, found, ok)
+	}
+
+	// Errors an Authenticator makes up are answered as unauthorized
+	recorder := httptest.NewRecorder()
+	writeError(recorder, asError(errors.New("banned"), ErrUnauthorized))
+	if recorder.Code != http.StatusUnauthorized || !strings.Contains(recorder.Body.String(), `"detail":"unauthorized: banned"`) {
+		t.Errorf("response = %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+// fetchFailingStorage fails to read SDPs with an error of its own
+type fetchFailingStorage struct {
+	Storage
+}
+
+func (s *fetchFailingStorage) GetSDPFromStorage(id string) (sdp *StoredSDP, err error) {
+	err = errors.New("dial tcp 10.0.0.3:6379: connection refused")
+	return
+}
+
+func TestWriteError_Internal(t *testing.T) {
+	logs := &syncBuffer{}
+	ss := New(
+		WithStorage(&fetchFailingStorage{Storage: NewMemoryStorage(0)}),
+		WithLogger(slog.New(slog.NewJSONHandler(logs, nil))),
+	)
+
+	recorder := httptest.NewRecorder()
+	ss.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sdp_fetch?id=stored", nil))
+
+	var envelope ErrorEnvelope
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusInternalServerError || envelope.Error == nil || envelope.Error.Code != CodeInternal || envelope.Error.Detail != "" {
+		t.Errorf("response = %d %s, want internal_error without detail", recorder.Code, recorder.Body.String())
+	}
+
+	if !strings.Contains(logs.String(), "10.0.0.3:6379") {
+		t.Errorf("logs lack the cause: %s", logs.String())
+	}
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
 )
 
 func main() {
 	s := webrtcsignalingserver.New()
-	go func() {
-		_, err := s.Listen(":80", nil)
-		panic(err)
+	err := s.Start(":80")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		s.Shutdown(ctx)
 	}()
 
 	wg := &sync.WaitGroup{}
@@ -0,0 +1,347 @@
+// Package filestorage keeps stored SDPs in an append-only JSON log on disk, so
+// a single node keeps them across restarts without an external service.
+//
+// Every change is appended and synced before it is acknowledged. The log is
+// compacted to the live entries whenever it is opened, once enough entries were
+// appended since the last compaction, or by Compact.
+package filestorage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+)
+
+const maxLogLineSize = 16 << 20
+
+// DefaultCompactAfter is how many entries are appended before the log is
+// compacted again, unless it held more live entries than that.
+const DefaultCompactAfter = 10000
+
+type logOp string
+
+const (
+	logPut    logOp = "put"
+	logDelete logOp = "delete"
+)
+
+type logEntry struct {
+	Op     logOp                            `json:"op"`
+	Id     string                           `json:"id"`
+	Record *webrtcsignalingserver.SDPRecord `json:"record,omitempty"`
+}
+
+// Storage serves everything from an embedded MemoryStorage and mirrors stored
+// SDP changes to the log. Listeners are never written to disk.
+type Storage struct {
+	*webrtcsignalingserver.MemoryStorage
+
+	path string
+	file *os.File
+
+	compactAfter int
+	// Entries in the log, and how many of them compaction wrote
+	logged    int
+	compacted int
+	dropped   int
+
+	// Keeps memory and log changes in the same order
+	m sync.Mutex
+}
+
+type Option func(s *Storage)
+
+// WithCompactAfter compacts the log once n entries were appended since the
+// last compaction, or as many as it kept if that is more. Zero turns it off.
+func WithCompactAfter(n int) Option {
+	return func(s *Storage) {
+		s.compactAfter = n
+	}
+}
+
+// Open replays the log at path, creating it if needed.
+func Open(path string, options ...Option) (s *Storage, err error) {
+	s = &Storage{
+		MemoryStorage: webrtcsignalingserver.NewMemoryStorage(webrtcsignalingserver.DefaultSweepInterval),
+		path:          path,
+		compactAfter:  DefaultCompactAfter,
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	err = s.replay()
+	if err == nil {
+		err = s.compact()
+	}
+
+	if err != nil {
+		s.MemoryStorage.Close()
+		s = nil
+		return
+	}
+
+	return
+}
+
+// Dropped returns how many log entries could not be replayed when the log was
+// opened, such as a write torn by a crash. Compaction removed them for good.
+func (s *Storage) Dropped() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.dropped
+}
+
+func (s *Storage) AddSDPToStorage(id, sdp string, data map[string]string, ttl time.Duration) (err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	err = s.MemoryStorage.AddSDPToStorage(id, sdp, data, ttl)
+	if err != nil {
+		return
+	}
+
+	var stored *webrtcsignalingserver.StoredSDP
+	stored, err = s.MemoryStorage.GetSDPFromStorage(id)
+	if err != nil {
+		return
+	}
+
+	err = s.append(&logEntry{Op: logPut, Id: id, Record: stored.Record("")})
+	if err != nil {
+		s.MemoryStorage.DeleteSDPFromStorage(id)
+		return
+	}
+
+	s.compactIfDue()
+	return
+}
+
+func (s *Storage) ConsumeSDPFromStorage(id string) (sdp *webrtcsignalingserver.StoredSDP, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	sdp, err = s.MemoryStorage.ConsumeSDPFromStorage(id)
+	if err != nil {
+		return
+	}
+
+	err = s.append(&logEntry{Op: logDelete, Id: id})
+	if err != nil {
+		// Not handed out, so it must not be gone either
+		s.MemoryStorage.ImportSDPToStorage(id, sdp)
+		sdp = nil
+		return
+	}
+
+	s.compactIfDue()
+	return
+}
+
+func (s *Storage) DeleteSDPFromStorage(id string) (err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	var sdp *webrtcsignalingserver.StoredSDP
+	sdp, err = s.MemoryStorage.ConsumeSDPFromStorage(id)
+	if err != nil {
+		return
+	}
+
+	err = s.append(&logEntry{Op: logDelete, Id: id})
+	if err != nil {
+		s.MemoryStorage.ImportSDPToStorage(id, sdp)
+		return
+	}
+
+	s.compactIfDue()
+	return
+}
+
+func (s *Storage) ImportSDPToStorage(id string, sdp *webrtcsignalingserver.StoredSDP) (err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	entry := &logEntry{Op: logPut, Id: id, Record: sdp.Record("")}
+	if sdp.Expired(time.Now()) {
+		entry = &logEntry{Op: logDelete, Id: id}
+	}
+
+	err = s.append(entry)
+	if err != nil {
+		return
+	}
+
+	err = s.MemoryStorage.ImportSDPToStorage(id, sdp)
+	if err == nil {
+		s.compactIfDue()
+	}
+	return
+}
+
+func (s *Storage) Close() (err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.MemoryStorage.Close()
+
+	if s.file != nil {
+		err = s.file.Close()
+		s.file = nil
+	}
+
+	return
+}
+
+func (s *Storage) replay() (err error) {
+	var file *os.File
+	file, err = os.Open(s.path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+
+	for scanner.Scan() {
+		var entry *logEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry == nil {
+			// Torn by a crash, compaction drops it
+			s.dropped++
+			continue
+		}
+
+		switch entry.Op {
+		case logPut:
+			if entry.Record == nil {
+				s.dropped++
+				continue
+			}
+
+			stored, recordErr := entry.Record.StoredSDP()
+			if recordErr != nil {
+				s.dropped++
+				continue
+			}
+
+			s.MemoryStorage.ImportSDPToStorage(entry.Id, stored)
+		case logDelete:
+			s.MemoryStorage.DeleteSDPFromStorage(entry.Id)
+		default:
+			s.dropped++
+		}
+	}
+
+	err = scanner.Err()
+	return
+}
+
+// Compact rewrites the log with only the entries that are still live.
+func (s *Storage) Compact() (err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	err = s.compact()
+	return
+}
+
+func (s *Storage) compact() (err error) {
+	tmpPath := s.path + ".tmp"
+
+	var tmp *os.File
+	tmp, err = os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+
+	written := 0
+	ids, _ := s.MemoryStorage.ListSDPsInStorage()
+	for _, id := range ids {
+		stored, getErr := s.MemoryStorage.GetSDPFromStorage(id)
+		if getErr != nil {
+			continue
+		}
+
+		if err = encoder.Encode(&logEntry{Op: logPut, Id: id, Record: stored.Record("")}); err != nil {
+			tmp.Close()
+			return
+		}
+		written++
+	}
+
+	if err = writer.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return
+	}
+
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		return
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	s.logged, s.compacted = written, written
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	return
+}
+
+func (s *Storage) append(entry *logEntry) (err error) {
+	if s.file == nil {
+		err = webrtcsignalingserver.ErrStorageClosed
+		return
+	}
+
+	var line []byte
+	line, err = json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return
+	}
+
+	if err = s.file.Sync(); err != nil {
+		return
+	}
+
+	s.logged++
+	return
+}
+
+// compactIfDue runs once memory matches the log again, so compaction keeps
+// the change that was just appended.
+func (s *Storage) compactIfDue() {
+	if s.compactAfter <= 0 || s.logged-s.compacted < max(s.compactAfter, s.compacted) {
+		return
+	}
+
+	// The change is already safe, a failed compaction only waits for the next round
+	if s.compact() != nil {
+		s.compacted = s.logged
+	}
+}
@@ -0,0 +1,149 @@
+package filestorage_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/aliforever/go-webrtc-signaling-server/filestorage"
+	"github.com/aliforever/go-webrtc-signaling-server/storagetest"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) webrtcsignalingserver.Storage {
+		s, err := filestorage.Open(filepath.Join(t.TempDir(), "sdps.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestStorage_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sdps.log")
+
+	offer, _ := webrtcsignalingserver.EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: storagetest.OfferSDP})
+
+	s, err := filestorage.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"kept", "consumed", "deleted"} {
+		if err = s.AddSDPToStorage(id, offer, map[string]string{"id": id}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before, _ := s.GetSDPFromStorage("kept")
+
+	if _, err = s.ConsumeSDPFromStorage("consumed"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteSDPFromStorage("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = filestorage.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ids, _ := s.ListSDPsInStorage()
+	if len(ids) != 1 || ids[0] != "kept" {
+		t.Fatalf("ListSDPsInStorage() after reopen = %v, want [kept]", ids)
+	}
+
+	after, err := s.GetSDPFromStorage("kept")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.SDP.Base64() != offer || after.SDP.Data()["id"] != "kept" ||
+		!after.CreatedAt.Equal(before.CreatedAt) || !after.ExpiresAt.Equal(before.ExpiresAt) {
+		t.Errorf("GetSDPFromStorage() after reopen = %+v, want %+v", after, before)
+	}
+}
+
+func TestStorage_CompactAfter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sdps.log")
+
+	offer, _ := webrtcsignalingserver.EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: storagetest.OfferSDP})
+
+	s, err := filestorage.Open(path, filestorage.WithCompactAfter(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = s.AddSDPToStorage("kept", offer, nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if err = s.AddSDPToStorage("churn", offer, nil, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err = s.DeleteSDPFromStorage("churn"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 11 entries were appended, compaction rewrote the log twice on the way
+	if lines := countLines(t, path); lines > 5 {
+		t.Errorf("log has %d lines, want it compacted", lines)
+	}
+}
+
+func TestStorage_Dropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sdps.log")
+
+	offer, _ := webrtcsignalingserver.EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: storagetest.OfferSDP})
+
+	s, err := filestorage.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AddSDPToStorage("kept", offer, nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"put","id":"bad","record":{"sdp":"%%%"}}` + "\n" + `{"op":"put","id":"torn","rec`)
+	file.Close()
+
+	s, err = filestorage.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if dropped := s.Dropped(); dropped != 2 {
+		t.Errorf("Dropped() = %d, want 2", dropped)
+	}
+
+	ids, _ := s.ListSDPsInStorage()
+	if len(ids) != 1 || ids[0] != "kept" {
+		t.Errorf("ListSDPsInStorage() = %v, want [kept]", ids)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Count(string(content), "\n")
+}
@@ -0,0 +1,150 @@
+package webrtcsignalingserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKS holds the keys JWTs are verified with, by kid.
+type JWKS struct {
+	keys map[string]*jwk
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+
+	alg string
+	key interface{}
+}
+
+// NewHS256JWKS holds a single HS256 secret, used for tokens without a kid.
+func NewHS256JWKS(secret []byte) *JWKS {
+	return &JWKS{keys: map[string]*jwk{"": {alg: "HS256", key: secret}}}
+}
+
+// LoadJWKSFile reads RSA (RS256), P-256 (ES256) and oct (HS256) keys from a
+// JWKS file, as {"keys": [...]}.
+func LoadJWKSFile(path string) (keys *JWKS, err error) {
+	var payload []byte
+	payload, err = os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	keys, err = ParseJWKS(payload)
+	return
+}
+
+func ParseJWKS(payload []byte) (keys *JWKS, err error) {
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+
+	err = json.Unmarshal(payload, &set)
+	if err != nil {
+		return
+	}
+
+	keys = &JWKS{keys: map[string]*jwk{}}
+	for _, key := range set.Keys {
+		if err = key.decode(); err != nil {
+			keys = nil
+			return
+		}
+
+		if _, exists := keys.keys[key.Kid]; exists {
+			err = errors.New("duplicate_kid")
+			keys = nil
+			return
+		}
+
+		keys.keys[key.Kid] = key
+	}
+
+	return
+}
+
+func (k *jwk) decode() (err error) {
+	switch k.Kty {
+	case "RSA":
+		var n, e []byte
+		if n, err = base64.RawURLEncoding.DecodeString(k.N); err != nil {
+			return
+		}
+		if e, err = base64.RawURLEncoding.DecodeString(k.E); err != nil {
+			return
+		}
+
+		k.alg = "RS256"
+		k.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		if k.Crv != "P-256" {
+			err = errors.New("unsupported_jwk_curve")
+			return
+		}
+
+		var x, y []byte
+		if x, err = base64.RawURLEncoding.DecodeString(k.X); err != nil {
+			return
+		}
+		if y, err = base64.RawURLEncoding.DecodeString(k.Y); err != nil {
+			return
+		}
+
+		k.alg = "ES256"
+		k.key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case "oct":
+		var secret []byte
+		if secret, err = base64.RawURLEncoding.DecodeString(k.K); err != nil {
+			return
+		}
+
+		k.alg = "HS256"
+		k.key = secret
+	default:
+		err = errors.New("unsupported_jwk_type")
+		return
+	}
+
+	if k.Alg != "" && k.Alg != k.alg {
+		err = errors.New("unsupported_jwk_alg")
+	}
+
+	return
+}
+
+// keyFunc picks the key of the token's kid, and refuses it for any other alg
+// so a public key can never be used as an HMAC secret.
+func (keys *JWKS) keyFunc(token *jwt.Token) (key interface{}, err error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k, exists := keys.keys[kid]
+	if !exists {
+		err = errors.New("unknown_kid")
+		return
+	}
+
+	if k.alg != token.Method.Alg() {
+		err = errors.New("alg_mismatch")
+		return
+	}
+
+	key = k.key
+	return
+}
@@ -0,0 +1,156 @@
+package webrtcsignalingserver
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Roles a JWT grants on the ids in its sub and aud claims.
+const (
+	JWTRolePublisher = "publisher"
+	JWTRoleViewer    = "viewer"
+)
+
+// jwtRoleActions lists what each role may do. Publishers store the SDPs
+// viewers fetch, both sides handshake and trickle candidates.
+var jwtRoleActions = map[string][]Action{
+	JWTRolePublisher: {ActionHandshake, ActionInform, ActionStore, ActionFetch, ActionCandidate, ActionRoom},
+	JWTRoleViewer:    {ActionHandshake, ActionInform, ActionFetch, ActionCandidate, ActionRoom},
+}
+
+type JWTClaims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// NewJWTClaims grants role on subject, and on every id in audience, for ttl.
+func NewJWTClaims(subject, role string, ttl time.Duration, audience ...string) *JWTClaims {
+	now := time.Now()
+
+	return &JWTClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+}
+
+// MintJWT signs claims for a backend to hand out. key is the HS256 secret as
+// []byte, or an *rsa.PrivateKey or *ecdsa.PrivateKey for RS256 and ES256; kid
+// names the key in the JWKS the server verifies against and may be empty.
+func MintJWT(method jwt.SigningMethod, key interface{}, kid string, claims *JWTClaims) (token string, err error) {
+	t := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		t.Header["kid"] = kid
+	}
+
+	token, err = t.SignedString(key)
+	return
+}
+
+// JWTAuthenticator accepts JWTs sent like bearer tokens and limits them to the
+// ids in their sub and aud claims, with what their role allows.
+type JWTAuthenticator struct {
+	keys   *JWKS
+	issuer string
+	leeway time.Duration
+}
+
+type JWTOption func(ja *JWTAuthenticator)
+
+// WithJWTIssuer rejects tokens from any other iss.
+func WithJWTIssuer(issuer string) JWTOption {
+	return func(ja *JWTAuthenticator) {
+		ja.issuer = issuer
+	}
+}
+
+// WithJWTLeeway tolerates clock skew on exp and nbf.
+func WithJWTLeeway(leeway time.Duration) JWTOption {
+	return func(ja *JWTAuthenticator) {
+		ja.leeway = leeway
+	}
+}
+
+// NewJWTAuthenticator verifies tokens against keys, see NewHS256JWKS and
+// LoadJWKSFile.
+func NewJWTAuthenticator(keys *JWKS, options ...JWTOption) *JWTAuthenticator {
+	ja := &JWTAuthenticator{keys: keys}
+
+	for _, option := range options {
+		option(ja)
+	}
+
+	return ja
+}
+
+func (ja *JWTAuthenticator) Authenticate(request *http.Request) (principal *Principal, err error) {
+	token := bearerToken(request)
+	if token == "" {
+		err = ErrMissingCredentials
+		return
+	}
+
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(ja.leeway),
+	}
+	if ja.issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(ja.issuer))
+	}
+
+	claims := &JWTClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, ja.keys.keyFunc, parserOptions...)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		err = ErrTokenExpired
+		return
+	}
+
+	if err != nil {
+		err = ErrInvalidToken
+		return
+	}
+
+	if _, known := jwtRoleActions[claims.Role]; !known {
+		err = ErrInvalidRole
+		return
+	}
+
+	principal = &Principal{
+		Subject:  claims.Subject,
+		Method:   "jwt",
+		Role:     claims.Role,
+		Audience: claims.Audience,
+	}
+	return
+}
+
+// Authorize lets principal act on id if id is its subject or in its audience,
+// and its role allows action.
+func (ja *JWTAuthenticator) Authorize(principal *Principal, action Action, id string) (err error) {
+	if principal == nil {
+		err = ErrMissingCredentials
+		return
+	}
+
+	if principal.Subject != id && !slices.Contains(principal.Audience, id) {
+		err = ErrTokenNotValidForID
+		return
+	}
+
+	if !slices.Contains(jwtRoleActions[principal.Role], action) {
+		err = ErrRoleNotAllowed
+		return
+	}
+
+	return
+}
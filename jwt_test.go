@@ -0,0 +1,140 @@
+package webrtcsignalingserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSignalingServer_JWT(t *testing.T) {
+	secret := []byte("secret")
+	ss := New(WithAuthenticator(NewJWTAuthenticator(NewHS256JWKS(secret))))
+
+	m := http.NewServeMux()
+	ss.register(m)
+
+	mint := func(claims *JWTClaims) string {
+		token, err := MintJWT(jwt.SigningMethodHS256, secret, "", claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	expired := NewJWTClaims("publisher", JWTRolePublisher, time.Minute)
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "no_token", path: "/sdp_store", wantStatus: http.StatusUnauthorized},
+		{name: "expired", path: "/sdp_store", token: mint(expired), wantStatus: http.StatusUnauthorized},
+		{name: "other_id", path: "/sdp_store", token: mint(NewJWTClaims("other", JWTRolePublisher, time.Minute)), wantStatus: http.StatusForbidden},
+		{name: "viewer_store", path: "/sdp_store", token: mint(NewJWTClaims("publisher", JWTRoleViewer, time.Minute)), wantStatus: http.StatusForbidden},
+		{name: "unknown_role", path: "/sdp_store", token: mint(NewJWTClaims("publisher", "admin", time.Minute)), wantStatus: http.StatusUnauthorized},
+		{name: "subject", path: "/sdp_store", token: mint(NewJWTClaims("publisher", JWTRolePublisher, time.Minute)), wantStatus: http.StatusOK},
+		{name: "audience", path: "/sdp_inform", token: mint(NewJWTClaims("backend", JWTRoleViewer, time.Minute, "publisher")), wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"id":"publisher","sdp":"` + testOfferBase64(t) + `"}`
+			request := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			recorder := httptest.NewRecorder()
+			m.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d %s, want %d", recorder.Code, recorder.Body.String(), tt.wantStatus)
+			}
+
+			ss.storage.DeleteSDPFromStorage("publisher")
+		})
+	}
+}
+
+func TestJWTAuthenticator_JWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	set := map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X.Bytes()), "y": encode(ecKey.Y.Bytes())},
+	}}
+
+	payload, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err = os.WriteFile(path, payload, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := NewJWTAuthenticator(keys)
+	claims := NewJWTClaims("publisher", JWTRoleViewer, time.Minute)
+
+	tests := []struct {
+		name    string
+		method  jwt.SigningMethod
+		key     interface{}
+		kid     string
+		wantErr bool
+	}{
+		{name: "rs256", method: jwt.SigningMethodRS256, key: rsaKey, kid: "rsa"},
+		{name: "es256", method: jwt.SigningMethodES256, key: ecKey, kid: "ec"},
+		{name: "unknown_kid", method: jwt.SigningMethodRS256, key: rsaKey, kid: "other", wantErr: true},
+		{name: "alg_mismatch", method: jwt.SigningMethodES256, key: ecKey, kid: "rsa", wantErr: true},
+		{name: "hs256_without_secret", method: jwt.SigningMethodHS256, key: []byte("secret"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := MintJWT(tt.method, tt.key, tt.kid, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, "/sdp_handshake", nil)
+			request.Header.Set("Authorization", "Bearer "+token)
+
+			principal, err := authenticator.Authenticate(request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (principal.Subject != "publisher" || principal.Role != JWTRoleViewer) {
+				t.Errorf("Authenticate() = %+v", principal)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+type lifecycle struct {
+	handler     *http.ServeMux
+	handlerOnce sync.Once
+
+	server   *http.Server
+	listener net.Listener
+	// Whether the server of Start or ListenTLS serves over TLS
+	tls bool
+	// Closed once Serve returned serveErr for the server of Start
+	served   chan struct{}
+	serveErr error
+	closing  bool
+	inFlight sync.WaitGroup
+	m        sync.Mutex
+}
+
+// Handler serves every endpoint, for mounting them in an existing server.
+// It is built once, later calls return the same handler.
+func (ss *SignalingServer) Handler() http.Handler {
+	ss.lifecycle.handlerOnce.Do(func() {
+		ss.lifecycle.handler = http.NewServeMux()
+		ss.register(ss.lifecycle.handler)
+	})
+
+	return ss.lifecycle.handler
+}
+
+// Start listens on address and serves Handler in the background until
+// Shutdown, over TLS when WithTLSConfig is set. Errors binding address are
+// returned, later ones end serving and are returned by Shutdown.
+func (ss *SignalingServer) Start(address string) (err error) {
+	ss.lifecycle.m.Lock()
+	defer ss.lifecycle.m.Unlock()
+
+	if ss.lifecycle.server != nil || ss.lifecycle.closing {
+		err = errors.New("server_already_started")
+		return
+	}
+
+	var listener net.Listener
+	listener, err = net.Listen("tcp", address)
+	if err != nil {
+		return
+	}
+
+	config := ss.serverTLSConfig()
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+
+	server := &http.Server{Handler: ss.Handler()}
+	served := make(chan struct{})
+	ss.lifecycle.server, ss.lifecycle.listener, ss.lifecycle.served = server, listener, served
+	ss.lifecycle.tls = config != nil
+
+	go func() {
+		defer close(served)
+		ss.lifecycle.serveErr = server.Serve(listener)
+	}()
+	return
+}
+
+// Addr is the address Start listens on, nil before Start.
+func (ss *SignalingServer) Addr() (addr net.Addr) {
+	ss.lifecycle.m.Lock()
+	defer ss.lifecycle.m.Unlock()
+
+	if ss.lifecycle.listener != nil {
+		addr = ss.lifecycle.listener.Addr()
+	}
+
+	return
+}
+
+// Shutdown stops taking new requests and waits, until ctx is done, for
+// pending handshakes to be answered. Every listener and room member still
+// registered is then released with ErrServerShutdown, the http server started
+// by Start or Listen is shut down and storage is closed. An error that ended
+// serving early for Start is returned.
+func (ss *SignalingServer) Shutdown(ctx context.Context) (err error) {
+	ss.lifecycle.m.Lock()
+	alreadyClosing := ss.lifecycle.closing
+	ss.lifecycle.closing = true
+	server, served := ss.lifecycle.server, ss.lifecycle.served
+	ss.lifecycle.m.Unlock()
+
+	if alreadyClosing {
+		err = errors.New("server_already_shut_down")
+		return
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		ss.lifecycle.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		// Whoever is still waiting is released below
+	}
+
+	ss.closeListeners()
+	ss.rooms.closeAll(map[string]string{"reason": ErrServerShutdown.Error()})
+
+	if server != nil {
+		err = server.Shutdown(ctx)
+	}
+
+	if served != nil {
+		// Serve returns right away once the server is shut down
+		<-served
+		if serveErr := ss.lifecycle.serveErr; !errors.Is(serveErr, http.ErrServerClosed) {
+			err = serveErr
+		}
+	}
+
+	if closeErr := ss.storage.Close(); err == nil {
+		err = closeErr
+	}
+
+	return
+}
+
+func (ss *SignalingServer) closeListeners() {
+	ids, _ := ss.storage.ListSDPListeners()
+	for _, id := range ids {
+		if l, err := ss.storage.FindSDPListener(id); err == nil {
+			l.Close(ErrServerShutdown)
+		}
+	}
+}
+
+// rejectWhenClosing turns requests away once Shutdown started.
+func (ss *SignalingServer) rejectWhenClosing(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		ss.lifecycle.m.Lock()
+		closing := ss.lifecycle.closing
+		ss.lifecycle.m.Unlock()
+
+		if closing {
+			writeError(writer, ErrServerShutdown)
+			return
+		}
+
+		handler(writer, request)
+	}
+}
+
+// beginHandshake counts a handshake Shutdown has to drain, it fails once
+// Shutdown started.
+func (ss *SignalingServer) beginHandshake() bool {
+	ss.lifecycle.m.Lock()
+	defer ss.lifecycle.m.Unlock()
+
+	if ss.lifecycle.closing {
+		return false
+	}
+
+	ss.lifecycle.inFlight.Add(1)
+	return true
+}
@@ -0,0 +1,142 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSignalingServer_Shutdown(t *testing.T) {
+	ss := New()
+	if err := ss.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ss.Start("127.0.0.1:0"); err == nil {
+		t.Error("Start() twice succeeded")
+	}
+
+	answered, err := ss.AddSDPListener("answered")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idle, err := ss.AddSDPListener("idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idleErr := make(chan error, 1)
+	go func() {
+		_, _, err := idle.ReadClientSDPContext(context.Background())
+		idleErr <- err
+	}()
+
+	// A handshake in flight when Shutdown starts is answered during the drain
+	status := make(chan int, 1)
+	go func() {
+		body := `{"id":"answered","sdp":"` + testOfferBase64(t) + `"}`
+		response, err := http.Post("http://"+ss.Addr().String()+"/sdp_handshake", "application/json", strings.NewReader(body))
+		if err != nil {
+			status <- 0
+			return
+		}
+		response.Body.Close()
+		status <- response.StatusCode
+	}()
+
+	answered.ReadClientSDP()
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		shutdownErr <- ss.Shutdown(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	recorder := httptest.NewRecorder()
+	ss.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/sdp_fetch?id=stored", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("request during Shutdown() status = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	if err = answered.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := <-status; code != http.StatusOK {
+		t.Errorf("in-flight handshake status = %d, want %d", code, http.StatusOK)
+	}
+
+	if err = <-shutdownErr; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+
+	if err = <-idleErr; err != ErrServerShutdown {
+		t.Errorf("idle listener error = %v, want %v", err, ErrServerShutdown)
+	}
+
+	if err = ss.Shutdown(context.Background()); err == nil {
+		t.Error("Shutdown() twice succeeded")
+	}
+}
+
+func TestSignalingServer_ShutdownDeadline(t *testing.T) {
+	ss := New()
+	handler := ss.Handler()
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read but never answered, Shutdown gives up draining at its deadline
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		body := `{"id":"publisher","sdp":"` + testOfferBase64(t) + `"}`
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+	}()
+
+	listener.ReadClientSDP()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err = ss.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	<-done
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), ErrServerShutdown.Error()) {
+		t.Errorf("handshake response = %d %s, want %s", recorder.Code, recorder.Body.String(), ErrServerShutdown)
+	}
+}
+
+func TestSignalingServer_ShutdownServeError(t *testing.T) {
+	ss := New()
+	if err := ss.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Serving ends on its own when the listener goes away under it
+	ss.lifecycle.listener.Close()
+	<-ss.lifecycle.served
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := ss.Shutdown(ctx); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Shutdown() error = %v, want %v", err, net.ErrClosed)
+	}
+}
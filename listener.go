@@ -1,50 +1,470 @@
 package webrtcsignalingserver
 
-import "github.com/pion/webrtc/v3"
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const listenerBufferSize = 32
+
+// maxPendingCandidates caps the candidates of each side nobody read yet.
+const maxPendingCandidates = 256
+
+type ListenerEventType string
+
+const (
+	ListenerEventConnected    ListenerEventType = "connected"
+	ListenerEventHeartbeat    ListenerEventType = "heartbeat"
+	ListenerEventTimeout      ListenerEventType = "timeout"
+	ListenerEventDisconnected ListenerEventType = "disconnected"
+)
+
+type ListenerEvent struct {
+	Type      ListenerEventType
+	CloseCode int
+	Reason    string
+	Time      time.Time
+}
+
+// ListenerState is how far the handshake on a listener got.
+type ListenerState string
+
+const (
+	ListenerIdle            ListenerState = "idle"
+	ListenerClientDelivered ListenerState = "client_delivered"
+	ListenerAnswered        ListenerState = "answered"
+	ListenerClosed          ListenerState = "closed"
+)
 
 type Listener struct {
 	clientSDP chan *SDPClient
 	serverSDP chan *SDPServer
+
+	clientCandidates *queue[*Candidate]
+	serverCandidates *queue[*Candidate]
+
+	clientMessage chan json.RawMessage
+	serverMessage chan json.RawMessage
+
+	events chan *ListenerEvent
+
+	done      chan struct{}
+	closeErr  error
+	closeOnce sync.Once
+
+	// Only set on listeners made by NewRelayListener
+	acks chan error
+
+	// Guarded by MemoryStorage.listenersM
+	consumed   bool
+	consumedAt time.Time
+
+	createdAt time.Time
+	state     ListenerState
+	stateM    sync.Mutex
+
+	// Only set on listeners made by NewSessionListener
+	sessions     chan *Session
+	sessionsByID map[string]*Session
+	sessionsM    sync.Mutex
+	// Held for reading while a session is delivered, so Close can close sessions
+	deliverM sync.RWMutex
+
+	// Only set on the listener of a Session
+	parent    *Listener
+	sessionID string
 }
 
-func newListener() *Listener {
+// NewListener makes a listener that is not registered anywhere. Storage
+// backends use it; applications register listeners with AddSDPListener.
+func NewListener() *Listener {
 	return &Listener{
-		clientSDP: make(chan *SDPClient),
-		serverSDP: make(chan *SDPServer),
+		clientSDP:        make(chan *SDPClient),
+		serverSDP:        make(chan *SDPServer),
+		clientCandidates: newQueue[*Candidate](),
+		serverCandidates: newQueue[*Candidate](),
+		clientMessage:    make(chan json.RawMessage, listenerBufferSize),
+		serverMessage:    make(chan json.RawMessage, listenerBufferSize),
+		events:           make(chan *ListenerEvent, listenerBufferSize),
+		done:             make(chan struct{}),
+		createdAt:        time.Now(),
+		state:            ListenerIdle,
+	}
+}
+
+// NewRelayListener makes a listener standing in for one owned elsewhere, e.g.
+// by another node. Writing a client SDP to it only returns once
+// AckClientSDP reports what the real owner made of it.
+func NewRelayListener() (l *Listener) {
+	l = NewListener()
+	l.acks = make(chan error, 1)
+	return
+}
+
+// AckClientSDP releases the writer of the client SDP read from a listener
+// made by NewRelayListener, with err when the real owner refused it.
+func (l *Listener) AckClientSDP(err error) {
+	if l.acks == nil {
+		return
+	}
+
+	select {
+	case l.acks <- err:
+	default:
 	}
 }
 
+// CreatedAt is when the listener was made.
+func (l *Listener) CreatedAt() time.Time {
+	return l.createdAt
+}
+
+// State is how far the handshake on the listener got, ListenerClosed once it
+// is closed.
+func (l *Listener) State() (state ListenerState) {
+	select {
+	case <-l.done:
+		return ListenerClosed
+	default:
+	}
+
+	l.stateM.Lock()
+	state = l.state
+	l.stateM.Unlock()
+	return
+}
+
+func (l *Listener) setState(state ListenerState) {
+	l.stateM.Lock()
+	l.state = state
+	l.stateM.Unlock()
+}
+
 func (l *Listener) WriteClientSDP(sdp string, data map[string]string) (err error) {
+	err = l.WriteClientSDPContext(context.Background(), sdp, data)
+	return
+}
+
+func (l *Listener) WriteClientSDPContext(ctx context.Context, sdp string, data map[string]string) (err error) {
 	var clientSDP *SDPClient
-	clientSDP, err = newClientSDP(sdp, data)
+	clientSDP, err = NewClientSDP(sdp, data)
 	if err != nil {
 		return
 	}
 
-	l.clientSDP <- clientSDP
+	err = l.writeClientSDP(ctx, clientSDP)
+	return
+}
+
+func (l *Listener) writeClientSDP(ctx context.Context, clientSDP *SDPClient) (err error) {
+	clientSDP.principal = PrincipalFromContext(ctx)
+	clientSDP.requestID = RequestIDFromContext(ctx)
+	clientSDP.spanContext = trace.SpanContextFromContext(ctx)
 
+	select {
+	case l.clientSDP <- clientSDP:
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	case <-l.done:
+		err = l.closeErr
+		return
+	}
+
+	if l.acks != nil {
+		select {
+		case err = <-l.acks:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-l.done:
+			err = l.closeErr
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	l.setState(ListenerClientDelivered)
 	return
 }
 
 func (l *Listener) WriteServerSDP(sdp *webrtc.SessionDescription, data map[string]string) (err error) {
+	err = l.WriteServerSDPContext(context.Background(), sdp, data)
+	return
+}
+
+func (l *Listener) WriteServerSDPContext(ctx context.Context, sdp *webrtc.SessionDescription, data map[string]string) (err error) {
 	var serverSDP *SDPServer
-	serverSDP, err = newServerSDP(sdp, data)
+	serverSDP, err = NewServerSDP(sdp, data)
 	if err != nil {
 		return
 	}
 
-	l.serverSDP <- serverSDP
+	err = l.WriteSDPServerContext(ctx, serverSDP)
+	return
+}
+
+// WriteSDPServerContext is WriteServerSDPContext taking an SDPServer made by
+// NewServerSDP, which keeps its SessionId when set, e.g. when relaying the
+// answer of a session. Any other SDPServer is refused with ErrInvalidSDP.
+func (l *Listener) WriteSDPServerContext(ctx context.Context, serverSDP *SDPServer) (err error) {
+	if serverSDP == nil || serverSDP.sdp == nil {
+		err = ErrInvalidSDP
+		return
+	}
+
+	if serverSDP.SessionId == "" {
+		serverSDP.SessionId = l.sessionID
+	}
+
+	select {
+	case l.serverSDP <- serverSDP:
+		l.setState(ListenerAnswered)
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-l.done:
+		err = l.closeErr
+	}
 
 	return
 }
 
 func (l *Listener) ReadClientSDP() (sdp *webrtc.SessionDescription, data map[string]string) {
-	clientSDP := <-l.clientSDP
+	sdp, data, _ = l.ReadClientSDPContext(context.Background())
+	return
+}
+
+func (l *Listener) ReadClientSDPContext(ctx context.Context) (sdp *webrtc.SessionDescription, data map[string]string, err error) {
+	var clientSDP *SDPClient
+	clientSDP, err = l.ReadSDPClientContext(ctx)
+	if err != nil {
+		return
+	}
+
 	sdp, data = clientSDP.sdp, clientSDP.Data()
 	return
 }
 
+// ReadSDPClientContext is ReadClientSDPContext returning the SDPClient as is,
+// with the Principal that sent it.
+func (l *Listener) ReadSDPClientContext(ctx context.Context) (clientSDP *SDPClient, err error) {
+	select {
+	case clientSDP = <-l.clientSDP:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-l.done:
+		err = l.closeErr
+	}
+
+	return
+}
+
 func (l *Listener) ReadServerSDP() (sdp *SDPServer) {
-	sdp = <-l.serverSDP
+	sdp, _ = l.ReadServerSDPContext(context.Background())
+	return
+}
+
+func (l *Listener) ReadServerSDPContext(ctx context.Context) (sdp *SDPServer, err error) {
+	select {
+	case sdp = <-l.serverSDP:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-l.done:
+		err = l.closeErr
+	}
+
 	return
 }
+
+// WriteClientCandidate queues a candidate for the owner of the listener. It
+// fails with ErrTooManyCandidates while maxPendingCandidates are unread, and
+// with the error the listener was closed with.
+func (l *Listener) WriteClientCandidate(candidate webrtc.ICECandidateInit) (err error) {
+	err = l.writeCandidate(l.clientCandidates, &Candidate{Candidate: &candidate})
+	return
+}
+
+func (l *Listener) WriteServerCandidate(candidate webrtc.ICECandidateInit) (err error) {
+	err = l.writeCandidate(l.serverCandidates, &Candidate{Candidate: &candidate})
+	return
+}
+
+func (l *Listener) WriteClientEndOfCandidates() (err error) {
+	err = l.writeCandidate(l.clientCandidates, &Candidate{EndOfCandidates: true})
+	return
+}
+
+func (l *Listener) WriteServerEndOfCandidates() (err error) {
+	err = l.writeCandidate(l.serverCandidates, &Candidate{EndOfCandidates: true})
+	return
+}
+
+func (l *Listener) writeCandidate(candidates *queue[*Candidate], candidate *Candidate) (err error) {
+	select {
+	case <-l.done:
+		err = l.closeErr
+		return
+	default:
+	}
+
+	if !candidates.pushBounded(candidate, maxPendingCandidates) {
+		err = ErrTooManyCandidates
+	}
+	return
+}
+
+// ReadClientCandidate blocks until the client trickles a candidate or its
+// end-of-candidates marker; it returns nil once the listener is closed.
+func (l *Listener) ReadClientCandidate() (candidate *Candidate) {
+	candidate, _ = l.ReadClientCandidateContext(context.Background())
+	return
+}
+
+// ReadClientCandidateContext is ReadClientCandidate until ctx is done. Once
+// the listener is closed and every candidate is read, it fails with the error
+// the listener was closed with.
+func (l *Listener) ReadClientCandidateContext(ctx context.Context) (candidate *Candidate, err error) {
+	candidate, err = l.readCandidate(ctx, l.clientCandidates)
+	return
+}
+
+func (l *Listener) ReadServerCandidate() (candidate *Candidate) {
+	candidate, _ = l.ReadServerCandidateContext(context.Background())
+	return
+}
+
+func (l *Listener) ReadServerCandidateContext(ctx context.Context) (candidate *Candidate, err error) {
+	candidate, err = l.readCandidate(ctx, l.serverCandidates)
+	return
+}
+
+func (l *Listener) readCandidate(ctx context.Context, candidates *queue[*Candidate]) (candidate *Candidate, err error) {
+	candidate, ok, err := candidates.popContext(ctx, l.done)
+	if err == nil && !ok {
+		err = l.closeErr
+	}
+	return
+}
+
+// PendingServerCandidates returns and forgets every server candidate nobody
+// has read yet; it never blocks.
+func (l *Listener) PendingServerCandidates() (candidates []*Candidate) {
+	candidates = l.serverCandidates.drain()
+	return
+}
+
+func (l *Listener) WriteClientMessage(message json.RawMessage) (err error) {
+	err = l.WriteClientMessageContext(context.Background(), message)
+	return
+}
+
+// WriteClientMessageContext blocks while the client messages buffer is full,
+// until ctx is done or the listener is closed.
+func (l *Listener) WriteClientMessageContext(ctx context.Context, message json.RawMessage) (err error) {
+	err = l.writeMessage(ctx, l.clientMessage, message)
+	return
+}
+
+func (l *Listener) WriteServerMessage(message json.RawMessage) (err error) {
+	err = l.WriteServerMessageContext(context.Background(), message)
+	return
+}
+
+func (l *Listener) WriteServerMessageContext(ctx context.Context, message json.RawMessage) (err error) {
+	err = l.writeMessage(ctx, l.serverMessage, message)
+	return
+}
+
+func (l *Listener) writeMessage(ctx context.Context, messages chan json.RawMessage, message json.RawMessage) (err error) {
+	// The buffer may have room after Close too
+	select {
+	case <-l.done:
+		err = l.closeErr
+		return
+	default:
+	}
+
+	select {
+	case messages <- message:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-l.done:
+		err = l.closeErr
+	}
+
+	return
+}
+
+func (l *Listener) ReadClientMessage() (message json.RawMessage) {
+	message, _ = l.ReadClientMessageContext(context.Background())
+	return
+}
+
+func (l *Listener) ReadClientMessageContext(ctx context.Context) (message json.RawMessage, err error) {
+	message, err = l.readMessage(ctx, l.clientMessage)
+	return
+}
+
+func (l *Listener) ReadServerMessage() (message json.RawMessage) {
+	message, _ = l.ReadServerMessageContext(context.Background())
+	return
+}
+
+func (l *Listener) ReadServerMessageContext(ctx context.Context) (message json.RawMessage, err error) {
+	message, err = l.readMessage(ctx, l.serverMessage)
+	return
+}
+
+func (l *Listener) readMessage(ctx context.Context, messages chan json.RawMessage) (message json.RawMessage, err error) {
+	select {
+	case message = <-messages:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-l.done:
+		err = l.closeErr
+	}
+
+	return
+}
+
+// Events reports the lifecycle of a websocket session bound to the listener.
+// Events are dropped if nobody drains the channel.
+func (l *Listener) Events() <-chan *ListenerEvent {
+	return l.events
+}
+
+func (l *Listener) emit(event *ListenerEvent) {
+	event.Time = time.Now()
+	select {
+	case l.events <- event:
+	default:
+	}
+}
+
+// Close wakes up everyone blocked on the listener with err. Closing a session
+// listener closes the sessions it did not forget (see IdleSessionTTL) and the
+// Sessions channel too. Only the first call has an effect.
+func (l *Listener) Close(err error) {
+	if err == nil {
+		err = ErrListenerClosed
+	}
+
+	l.closeOnce.Do(func() {
+		l.closeErr = err
+		close(l.done)
+
+		if l.parent != nil {
+			l.parent.forgetSession(l.sessionID)
+		}
+
+		if l.sessions != nil {
+			l.closeSessions(err)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestListener_ReadClientSDPContext(t *testing.T) {
+	l := NewListener()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err := l.ReadClientSDPContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("ReadClientSDPContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	_, err = l.ReadServerSDPContext(ctx)
+	if err != context.Canceled {
+		t.Fatalf("ReadServerSDPContext() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestListener_WriteSDPServerContext(t *testing.T) {
+	l := NewListener()
+
+	for _, serverSDP := range []*SDPServer{nil, {SDPBase64: "e30=", Data: map[string]string{"k": "v"}}} {
+		if err := l.WriteSDPServerContext(t.Context(), serverSDP); err != ErrInvalidSDP {
+			t.Errorf("WriteSDPServerContext(%+v) = %v, want %v", serverSDP, err, ErrInvalidSDP)
+		}
+	}
+
+	if _, err := NewServerSDP(nil, nil); err != ErrInvalidSDP {
+		t.Errorf("NewServerSDP(nil) = %v, want %v", err, ErrInvalidSDP)
+	}
+}
+
+func TestSignalingServer_HandshakeTimeout(t *testing.T) {
+	ss := New(WithHandshakeTimeout(50 * time.Millisecond))
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offer, _ := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	body := `{"id":"publisher","sdp":"` + offer + `"}`
+
+	written := make(chan error)
+	go func() {
+		listener.ReadClientSDP()
+		// Never answer in time, the handler has to give up and release us
+		time.Sleep(100 * time.Millisecond)
+		written <- listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0"}, nil)
+	}()
+
+	recorder := httptest.NewRecorder()
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+
+	if recorder.Code != http.StatusGatewayTimeout || !strings.Contains(recorder.Body.String(), "handshake_timeout") {
+		t.Fatalf("response = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if err = <-written; err != context.DeadlineExceeded {
+		t.Fatalf("WriteServerSDP() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,139 @@
+package webrtcsignalingserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// RequestIDHeader carries the correlation id of a request. A client may send
+// its own, the response always carries the one used.
+const RequestIDHeader = "X-Request-Id"
+
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+type loggerContextKey struct{}
+
+type endpointContextKey struct{}
+
+// ContextWithRequestID attaches a correlation id to ctx. Client SDPs
+// delivered with such a context carry it, see SDPClient.RequestID.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) (requestID string) {
+	requestID, _ = ctx.Value(requestIDContextKey{}).(string)
+	return
+}
+
+// endpointFromContext is the endpoint the request of ctx was made to.
+func endpointFromContext(ctx context.Context) (endpoint string) {
+	endpoint, _ = ctx.Value(endpointContextKey{}).(string)
+	return
+}
+
+// requestLogger is the logger of the request ctx belongs to, the server's
+// logger outside of requests.
+func (ss *SignalingServer) requestLogger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return ss.logger
+}
+
+// correlate gives every request to endpoint a correlation id, returned in
+// RequestIDHeader, and a logger carrying it, and logs the errors answered.
+func (ss *SignalingServer) correlate(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		requestID := request.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			var err error
+			if requestID, err = newToken(); err != nil {
+				ss.logger.Error("request id not generated", "endpoint", endpoint, "error", err.Error())
+				writeError(writer, err)
+				return
+			}
+		}
+		writer.Header().Set(RequestIDHeader, requestID)
+
+		logger := ss.logger.With("request_id", requestID, "endpoint", endpoint)
+
+		ctx := ContextWithRequestID(request.Context(), requestID)
+		ctx = context.WithValue(ctx, loggerContextKey{}, logger)
+		ctx = context.WithValue(ctx, endpointContextKey{}, endpoint)
+
+		recorder := &statusRecorder{ResponseWriter: writer}
+		handler(recorder, request.WithContext(ctx))
+
+		if recorder.err != nil {
+			logError(ctx, logger, recorder.err)
+		}
+	}
+}
+
+// logError logs an error answered to a client, at error level when it is the
+// server's fault.
+func logError(ctx context.Context, logger *slog.Logger, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = ErrInternal
+	}
+
+	level := slog.LevelInfo
+	if e.status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+
+	logger.Log(ctx, level, "error", "code", e.code, "status", e.status, "error", err.Error())
+}
+
+// statusRecorder records the status of a response and the error writeError
+// answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	err    error
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Hijack lets /ws upgrade through the recorder.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response_not_hijackable")
+	}
+
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// recordError tells the statusRecorder under writer, if any, what writeError
+// answered with.
+func recordError(writer http.ResponseWriter, err error) {
+	if recorder, ok := writer.(*statusRecorder); ok {
+		recorder.err = err
+	}
+}
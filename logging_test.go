@@ -0,0 +1,120 @@
+package webrtcsignalingserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// syncBuffer is written to by handlers and read by the test.
+type syncBuffer struct {
+	b bytes.Buffer
+	m sync.Mutex
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.m.Lock()
+	defer sb.m.Unlock()
+	return sb.b.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.m.Lock()
+	defer sb.m.Unlock()
+	return sb.b.String()
+}
+
+func TestSignalingServer_Logging(t *testing.T) {
+	logs := &syncBuffer{}
+	ss := New(WithLogger(slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+
+	server := httptest.NewServer(ss.Handler())
+	defer server.Close()
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestIDs := make(chan string, 1)
+	go func() {
+		clientSDP, err := listener.ReadSDPClientContext(t.Context())
+		if err != nil {
+			return
+		}
+
+		requestIDs <- clientSDP.RequestID()
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testOfferSDP}, nil)
+	}()
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/sdp_handshake", strings.NewReader(`{"id":"publisher","sdp":"`+offer+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set(RequestIDHeader, "trace-1")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if got := response.Header.Get(RequestIDHeader); got != "trace-1" {
+		t.Errorf("%s = %q, want trace-1", RequestIDHeader, got)
+	}
+
+	if got := <-requestIDs; got != "trace-1" {
+		t.Errorf("SDPClient.RequestID() = %q, want trace-1", got)
+	}
+
+	response, err = http.Post(server.URL+"/sdp_handshake", "application/json", strings.NewReader(`{"id":"nobody","sdp":"`+offer+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	generated := response.Header.Get(RequestIDHeader)
+	if generated == "" {
+		t.Fatalf("no %s without one in the request", RequestIDHeader)
+	}
+
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var event map[string]interface{}
+		if err = json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+
+	for _, want := range []struct{ requestID, msg string }{
+		{"trace-1", "request parsed"},
+		{"trace-1", "listener consumed"},
+		{"trace-1", "client SDP delivered"},
+		{"trace-1", "server SDP returned"},
+		{generated, "error"},
+	} {
+		found := false
+		for _, event := range events {
+			if event["request_id"] == want.requestID && event["msg"] == want.msg && event["endpoint"] == "sdp_handshake" {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("no %q event for request %s in:\n%s", want.msg, want.requestID, logs.String())
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package webrtcsignalingserver
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultSweepInterval = time.Minute
+
+// ConsumedListenerTTL is how long a consumed listener stays findable by id,
+// for candidates trickled after its handshake, unless it is closed first.
+const ConsumedListenerTTL = time.Minute
+
+// MemoryStorage is the default Storage. Nothing survives a restart.
+type MemoryStorage struct {
+	listeners map[string]*Listener
+	storage   map[string]*StoredSDP
+
+	// Lockers
+	listenersM sync.Mutex
+	storageM   sync.Mutex
+
+	// Guarded by storageM
+	notifyExpired func(id string, sdp *StoredSDP)
+	storedBytes   int64
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemoryStorage removes expired SDPs every sweepInterval until Close is
+// called. A non-positive sweepInterval disables the sweeper, expired entries
+// are then only hidden from reads.
+func NewMemoryStorage(sweepInterval time.Duration) (ms *MemoryStorage) {
+	ms = &MemoryStorage{
+		listeners: map[string]*Listener{},
+		storage:   map[string]*StoredSDP{},
+		stop:      make(chan struct{}),
+	}
+
+	if sweepInterval > 0 {
+		go ms.runSweeper(sweepInterval)
+	}
+
+	return
+}
+
+func (ms *MemoryStorage) AddSDPListener(id string) (l *Listener, err error) {
+	l, err = ms.addSDPListener(id, NewListener())
+	return
+}
+
+func (ms *MemoryStorage) AddSDPSessionListener(id string) (l *Listener, err error) {
+	l, err = ms.addSDPListener(id, NewSessionListener())
+	return
+}
+
+func (ms *MemoryStorage) addSDPListener(id string, added *Listener) (l *Listener, err error) {
+	ms.listenersM.Lock()
+	defer ms.listenersM.Unlock()
+
+	// A consumed listener only stays around for trickled candidates, so it can be replaced
+	if existing, exists := ms.listeners[id]; exists && !existing.consumed {
+		err = ErrListenerExists
+		return
+	}
+
+	l = added
+	ms.listeners[id] = l
+
+	return
+}
+
+func (ms *MemoryStorage) GetSDPListener(id string) (l *Listener, err error) {
+	ms.listenersM.Lock()
+	defer ms.listenersM.Unlock()
+
+	var exists bool
+	l, exists = ms.listeners[id]
+	if !exists || l.consumed {
+		l = nil
+		err = ErrListenerNotFound
+		return
+	}
+
+	if l.sessions != nil {
+		return
+	}
+
+	// Mark Listener as consumed to prevent others access the same listener.
+	// It is kept in storage so candidates can still be trickled by id, until
+	// it is swept.
+	l.consumed, l.consumedAt = true, time.Now()
+	return
+}
+
+// stale tells whether l was consumed and is closed or past
+// ConsumedListenerTTL, so nothing can be trickled to it any more. Called with
+// listenersM held.
+func (ms *MemoryStorage) stale(l *Listener, now time.Time) bool {
+	if !l.consumed {
+		return false
+	}
+
+	select {
+	case <-l.done:
+		return true
+	default:
+	}
+
+	return now.Sub(l.consumedAt) >= ConsumedListenerTTL
+}
+
+func (ms *MemoryStorage) FindSDPListener(id string) (l *Listener, err error) {
+	ms.listenersM.Lock()
+	defer ms.listenersM.Unlock()
+
+	var exists bool
+	l, exists = ms.listeners[id]
+	if exists && ms.stale(l, time.Now()) {
+		delete(ms.listeners, id)
+		exists = false
+	}
+
+	if !exists {
+		l = nil
+		err = ErrListenerNotFound
+		return
+	}
+
+	return
+}
+
+func (ms *MemoryStorage) RemoveSDPListener(id string) (err error) {
+	ms.listenersM.Lock()
+	defer ms.listenersM.Unlock()
+
+	if _, exists := ms.listeners[id]; !exists {
+		err = ErrListenerNotFound
+		return
+	}
+
+	delete(ms.listeners, id)
+	return
+}
+
+func (ms *MemoryStorage) ListSDPListeners() (ids []string, err error) {
+	ms.listenersM.Lock()
+	defer ms.listenersM.Unlock()
+
+	now := time.Now()
+
+	ids = make([]string, 0, len(ms.listeners))
+	for id, l := range ms.listeners {
+		if ms.stale(l, now) {
+			delete(ms.listeners, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return
+}
+
+func (ms *MemoryStorage) AddSDPToStorage(id, sdp string, data map[string]string, ttl time.Duration) (err error) {
+	ms.storageM.Lock()
+	defer ms.storageM.Unlock()
+
+	now := time.Now()
+	if existing, exists := ms.storage[id]; exists && !existing.Expired(now) {
+		err = ErrSDPExists
+		return
+	}
+
+	var remoteSdp *SDPClient
+	remoteSdp, err = NewClientSDP(sdp, data)
+	if err != nil {
+		return
+	}
+
+	entry := &StoredSDP{SDP: remoteSdp, CreatedAt: now}
+	if ttl > 0 {
+		entry.ExpiresAt = now.Add(ttl)
+	}
+
+	ms.put(id, entry)
+	return
+}
+
+func (ms *MemoryStorage) GetSDPFromStorage(id string) (sdp *StoredSDP, err error) {
+	ms.storageM.Lock()
+	defer ms.storageM.Unlock()
+
+	var exists bool
+	if sdp, exists = ms.storage[id]; !exists || sdp.Expired(time.Now()) {
+		sdp = nil
+		err = ErrSDPNotFound
+		return
+	}
+
+	return
+}
+
+// ConsumeSDPFromStorage is GetSDPFromStorage that also deletes the entry, so
+// each stored SDP is handed out at most once.
+func (ms *MemoryStorage) ConsumeSDPFromStorage(id string) (sdp *StoredSDP, err error) {
+	ms.storageM.Lock()
+	defer ms.storageM.Unlock()
+
+	var exists bool
+	if sdp, exists = ms.storage[id]; !exists || sdp.Expired(time.Now()) {
+		sdp = nil
+		err = ErrSDPNotFound
+		return
+	}
+
+	ms.remove(id)
+	return
+}
+
+func (ms *MemoryStorage) DeleteSDPFromStorage(id string) (err error) {
+	ms.storageM.Lock()
+	defer ms.storageM.Unlock()
+
+	if sdp, exists := ms.storage[id]; !exists || sdp.Expired(time.Now()) {
+		err = ErrSDPNotFound
+		return
+	}
+
+	ms.remove(id)
+	return
+}
+
+func (ms *MemoryStorage) ListSDPsInStorage() (ids []string, err error) {
+	ms.storageM.Lock()
+	defer ms.storageM.Unlock()
+
+	now := time.Now()
+
+	ids = make([]string, 0, len(ms.storage))
+	for id, sdp := range ms.storage {
+		if !sdp.Expired(now) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+	return
+}
+
+func (ms *MemoryStorage) ImportSDPToStorage(id string, sdp *StoredSDP) (err error) {
+	ms.storageM.Lock()
+	defer ms.storageM.Unlock()
+
+	if sdp.Expired(time.Now()) {
+		ms.remove(id)
+		return
+	}
+
+	imported := *sdp
+	ms.put(id, &imported)
+	return
+}
+
+// StoredSDPBytes is the size of every SDP in storage, expired ones included
+// until they are swept, see StoredSizer.
+func (ms *MemoryStorage) StoredSDPBytes() (bytes int64, err error) {
+	ms.storageM.Lock()
+	defer ms.storageM.Unlock()
+
+	bytes = ms.storedBytes
+	return
+}
+
+// put must be called with storageM held.
+func (ms *MemoryStorage) put(id string, entry *StoredSDP) {
+	ms.remove(id)
+
+	ms.storage[id] = entry
+	ms.storedBytes += entry.size()
+}
+
+// remove must be called with storageM held.
+func (ms *MemoryStorage) remove(id string) {
+	if entry, exists := ms.storage[id]; exists {
+		delete(ms.storage, id)
+		ms.storedBytes -= entry.size()
+	}
+}
+
+func (ms *MemoryStorage) Close() (err error) {
+	ms.closeOnce.Do(func() {
+		close(ms.stop)
+	})
+	return
+}
+
+// NotifyExpired makes notify the function sweeps call for every SDP they
+// remove, see ExpiryNotifier.
+func (ms *MemoryStorage) NotifyExpired(notify func(id string, sdp *StoredSDP)) {
+	ms.storageM.Lock()
+	defer ms.storageM.Unlock()
+
+	ms.notifyExpired = notify
+}
+
+func (ms *MemoryStorage) sweep(now time.Time) (removed int) {
+	ms.storageM.Lock()
+
+	expired := map[string]*StoredSDP{}
+	for id, entry := range ms.storage {
+		if entry.Expired(now) {
+			ms.remove(id)
+			expired[id] = entry
+		}
+	}
+
+	notify := ms.notifyExpired
+	ms.storageM.Unlock()
+
+	// Outside of the lock, so notify may use the storage
+	if notify != nil {
+		for id, entry := range expired {
+			notify(id, entry)
+		}
+	}
+
+	removed = len(expired)
+	return
+}
+
+// sweepListeners forgets the consumed listeners that went stale.
+func (ms *MemoryStorage) sweepListeners(now time.Time) (removed int) {
+	ms.listenersM.Lock()
+	defer ms.listenersM.Unlock()
+
+	for id, l := range ms.listeners {
+		if ms.stale(l, now) {
+			delete(ms.listeners, id)
+			removed++
+		}
+	}
+	return
+}
+
+func (ms *MemoryStorage) runSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			ms.sweep(now)
+			ms.sweepListeners(now)
+		case <-ms.stop:
+			return
+		}
+	}
+}
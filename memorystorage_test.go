@@ -0,0 +1,89 @@
+package webrtcsignalingserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// testOfferSDP is the smallest offer ParseSDP accepts.
+const testOfferSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=fingerprint:sha-256 E6:32:0F:C2:21:A8:C1:C7:8C:AA:24:A8:F7:49:D5:3A:22:88:68:58:82:37:EA:C9:B0:33:1E:62:62:5F:0B:FA\r\n" +
+	"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=ice-ufrag:sMbxeGwbcSAFhgEf\r\n" +
+	"a=ice-pwd:piRMgOyfeyBThjzuaAOxrdUedsOYSmlt\r\n" +
+	"a=mid:0\r\n" +
+	"a=sctp-port:5000\r\n"
+
+func testOfferBase64(t *testing.T) string {
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offer
+}
+
+func TestMemoryStorage_Sweep(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	offer := testOfferBase64(t)
+
+	if err := ms.AddSDPToStorage("short", offer, nil, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.AddSDPToStorage("forever", offer, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if removed := ms.sweep(time.Now()); removed != 1 {
+		t.Errorf("sweep() removed = %d, want 1", removed)
+	}
+	if _, err := ms.GetSDPFromStorage("forever"); err != nil {
+		t.Errorf("GetSDPFromStorage() error = %v", err)
+	}
+}
+
+func TestMemoryStorage_SweepListeners(t *testing.T) {
+	ms := NewMemoryStorage(0)
+	defer ms.Close()
+
+	for _, id := range []string{"answered", "closed", "idle"} {
+		if _, err := ms.AddSDPListener(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"answered", "closed"} {
+		if _, err := ms.GetSDPListener(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed, _ := ms.FindSDPListener("closed")
+	closed.Close(nil)
+
+	// Consumed listeners stay findable for trickled candidates, closed ones do not
+	if _, err := ms.FindSDPListener("answered"); err != nil {
+		t.Errorf("FindSDPListener() right after the handshake = %v", err)
+	}
+	if _, err := ms.FindSDPListener("closed"); err != ErrListenerNotFound {
+		t.Errorf("FindSDPListener() on a closed consumed listener = %v, want %v", err, ErrListenerNotFound)
+	}
+
+	if removed := ms.sweepListeners(time.Now().Add(ConsumedListenerTTL)); removed != 1 {
+		t.Errorf("sweepListeners() removed %d, want 1", removed)
+	}
+
+	ids, err := ms.ListSDPListeners()
+	if err != nil || len(ids) != 1 || ids[0] != "idle" {
+		t.Errorf("ListSDPListeners() = %v, %v, want only the idle listener", ids, err)
+	}
+}
@@ -0,0 +1,232 @@
+package webrtcsignalingserver
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "webrtc_signaling"
+
+// handshakeEndpoints are the endpoints counted as handshakes at the http
+// level; WebSocket handshakes are counted per offer frame instead.
+var handshakeEndpoints = map[string]bool{
+	"sdp_handshake": true,
+	"sdp_inform":    true,
+}
+
+// metrics are the Prometheus collectors of a SignalingServer, see WithMetrics.
+// A nil *metrics records nothing.
+type metrics struct {
+	handshakesStarted   *prometheus.CounterVec
+	handshakesCompleted *prometheus.CounterVec
+	handshakesFailed    *prometheus.CounterVec
+	answerDuration      *prometheus.HistogramVec
+	errors              *prometheus.CounterVec
+
+	handler http.Handler
+}
+
+func newMetrics(ss *SignalingServer, registerer prometheus.Registerer) (m *metrics) {
+	if registerer == nil {
+		// A registry of its own, so several servers fit in one process
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		registerer = registry
+	}
+
+	m = &metrics{
+		handshakesStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "handshakes_started_total",
+			Help:      "Handshakes started, by endpoint.",
+		}, []string{"endpoint"}),
+		handshakesCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "handshakes_completed_total",
+			Help:      "Handshakes completed, by endpoint.",
+		}, []string{"endpoint"}),
+		handshakesFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "handshakes_failed_total",
+			Help:      "Handshakes failed, by endpoint.",
+		}, []string{"endpoint"}),
+		answerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "answer_duration_seconds",
+			Help:      "Time from a client SDP being delivered to a listener to its answer being read.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		}, []string{"endpoint"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "errors_total",
+			Help:      "Errors answered to clients, by code.",
+		}, []string{"code"}),
+	}
+
+	registerer.MustRegister(
+		m.handshakesStarted,
+		m.handshakesCompleted,
+		m.handshakesFailed,
+		m.answerDuration,
+		m.errors,
+		&serverCollector{ss: ss},
+	)
+
+	gatherer, ok := registerer.(prometheus.Gatherer)
+	if !ok {
+		gatherer = prometheus.DefaultGatherer
+	}
+	m.handler = promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+
+	return
+}
+
+func (m *metrics) handshakeStarted(endpoint string) {
+	if m != nil {
+		m.handshakesStarted.WithLabelValues(endpoint).Inc()
+	}
+}
+
+func (m *metrics) handshakeDone(endpoint string, ok bool) {
+	if m == nil {
+		return
+	}
+
+	if ok {
+		m.handshakesCompleted.WithLabelValues(endpoint).Inc()
+	} else {
+		m.handshakesFailed.WithLabelValues(endpoint).Inc()
+	}
+}
+
+func (m *metrics) answered(endpoint string, since time.Time) {
+	if m != nil {
+		m.answerDuration.WithLabelValues(endpoint).Observe(time.Since(since).Seconds())
+	}
+}
+
+func (m *metrics) error(err error) {
+	if m == nil {
+		return
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		e = ErrInternal
+	}
+	m.errors.WithLabelValues(string(e.code)).Inc()
+}
+
+// instrument counts the handshakes and errors of the requests to endpoint.
+func (ss *SignalingServer) instrument(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	if ss.metrics == nil {
+		return handler
+	}
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		handshake := handshakeEndpoints[endpoint]
+		if handshake {
+			ss.metrics.handshakeStarted(endpoint)
+		}
+
+		// correlate records every response, see wrap
+		recorder, ok := writer.(*statusRecorder)
+		if !ok {
+			recorder = &statusRecorder{ResponseWriter: writer}
+		}
+		handler(recorder, request)
+
+		if recorder.err != nil {
+			ss.metrics.error(recorder.err)
+		}
+
+		if handshake {
+			// Nothing written means the client went away before its answer
+			ss.metrics.handshakeDone(endpoint, recorder.status != 0 && recorder.status < http.StatusBadRequest)
+		}
+	}
+}
+
+// StoredSizer is implemented by Storages that keep the total size of their
+// stored SDPs up to date, so metrics can report it without reading every SDP.
+// MemoryStorage does.
+type StoredSizer interface {
+	StoredSDPBytes() (bytes int64, err error)
+}
+
+// serverCollector reads the state of a SignalingServer on every scrape:
+// listeners, stored SDPs and the candidates its CandidatePolicy dropped. It
+// only lists storage, so a scrape costs the same however big the SDPs are.
+type serverCollector struct {
+	ss *SignalingServer
+}
+
+var (
+	listenersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "listeners"),
+		"Listeners registered.", nil, nil)
+	storedSDPsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "stored_sdps"),
+		"SDPs in storage.", nil, nil)
+	storedSDPBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "stored_sdp_bytes"),
+		"Size of the SDPs in storage, for storages implementing StoredSizer.", nil, nil)
+	filteredCandidatesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "filtered_candidates_total"),
+		"ICE candidates dropped by the candidate policy, by origin and reason.", []string{"origin", "reason"}, nil)
+)
+
+func (c *serverCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- listenersDesc
+	descs <- storedSDPsDesc
+	descs <- storedSDPBytesDesc
+	descs <- filteredCandidatesDesc
+}
+
+func (c *serverCollector) Collect(collected chan<- prometheus.Metric) {
+	if listeners, err := c.ss.storage.ListSDPListeners(); err == nil {
+		collected <- prometheus.MustNewConstMetric(listenersDesc, prometheus.GaugeValue, float64(len(listeners)))
+	}
+
+	if ids, err := c.ss.storage.ListSDPsInStorage(); err == nil {
+		collected <- prometheus.MustNewConstMetric(storedSDPsDesc, prometheus.GaugeValue, float64(len(ids)))
+	}
+
+	if sizer, ok := c.ss.storage.(StoredSizer); ok {
+		if bytes, err := sizer.StoredSDPBytes(); err == nil {
+			collected <- prometheus.MustNewConstMetric(storedSDPBytesDesc, prometheus.GaugeValue, float64(bytes))
+		}
+	}
+
+	for _, count := range c.ss.FilteredCandidates() {
+		collected <- prometheus.MustNewConstMetric(filteredCandidatesDesc, prometheus.CounterValue, float64(count.Count),
+			string(count.Origin), string(count.Reason))
+	}
+}
+
+// wsAnswerClock times the answers of a WebSocket session from its last offer.
+type wsAnswerClock struct {
+	offeredAt atomic.Int64
+}
+
+func (c *wsAnswerClock) offered() {
+	c.offeredAt.Store(time.Now().UnixNano())
+}
+
+// since is when the pending offer was delivered; ok is false when there is
+// none, e.g. for an answer the listener sent first.
+func (c *wsAnswerClock) since() (offeredAt time.Time, ok bool) {
+	nanos := c.offeredAt.Swap(0)
+	if nanos == 0 {
+		return
+	}
+
+	offeredAt, ok = time.Unix(0, nanos), true
+	return
+}
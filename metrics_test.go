@@ -0,0 +1,141 @@
+package webrtcsignalingserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSignalingServer_Metrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ss := New(WithMetrics(registry), WithCandidatePolicy(CandidatePolicy{DropHost: true}))
+
+	server := httptest.NewServer(ss.Handler())
+	defer server.Close()
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := listener.ReadSDPClientContext(t.Context()); err != nil {
+			return
+		}
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testOfferSDP}, nil)
+	}()
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testVideoOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{
+		`{"id":"publisher","sdp":"` + offer + `"}`,
+		`{"id":"nobody","sdp":"` + offer + `"}`,
+	} {
+		response, err := http.Post(server.URL+"/sdp_handshake", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+
+	response, err := http.Post(server.URL+"/sdp_store", "application/json", strings.NewReader(`{"id":"stored","sdp":"`+offer+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if _, err = ss.AddSDPListener("idle"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stored as rewritten by the candidate policy
+	stored, err := ss.storage.GetSDPFromStorage("stored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored.SDP.SDP().SDP, "typ host") {
+		t.Errorf("stored SDP was not filtered:\n%s", stored.SDP.SDP().SDP)
+	}
+
+	response, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	payload, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(payload)
+
+	for _, want := range []string{
+		`webrtc_signaling_handshakes_started_total{endpoint="sdp_handshake"} 2`,
+		`webrtc_signaling_handshakes_completed_total{endpoint="sdp_handshake"} 1`,
+		`webrtc_signaling_handshakes_failed_total{endpoint="sdp_handshake"} 1`,
+		`webrtc_signaling_answer_duration_seconds_count{endpoint="sdp_handshake"} 1`,
+		`webrtc_signaling_errors_total{code="listener_does_not_exist"} 1`,
+		`webrtc_signaling_listeners 2`,
+		`webrtc_signaling_stored_sdps 1`,
+		`webrtc_signaling_stored_sdp_bytes ` + strconv.Itoa(len(stored.SDP.SDP().SDP)),
+		`webrtc_signaling_filtered_candidates_total{origin="client",reason="host"} 3`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("/metrics lacks %q", want)
+		}
+	}
+}
+
+func TestSignalingServer_MetricsStoredBytes(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ss := New(WithMetrics(registry))
+
+	offer := testOfferBase64(t)
+	for _, id := range []string{"consumed", "deleted", "kept"} {
+		if err := ss.storage.AddSDPToStorage(id, offer, nil, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ss.storage.ConsumeSDPFromStorage("consumed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.storage.DeleteSDPFromStorage("deleted"); err != nil {
+		t.Fatal(err)
+	}
+
+	kept, _ := ss.storage.GetSDPFromStorage("kept")
+	if got, want := gatherGauge(t, registry, "webrtc_signaling_stored_sdp_bytes"), float64(len(kept.SDP.SDP().SDP)); got != want {
+		t.Errorf("stored_sdp_bytes = %v, want %v", got, want)
+	}
+
+	// Servers without a registerer of their own do not collide
+	New(WithMetrics(nil))
+	New(WithMetrics(nil))
+}
+
+func gatherGauge(t *testing.T, gatherer prometheus.Gatherer, name string) float64 {
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) == 1 {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+
+	t.Fatalf("%s was not gathered", name)
+	return 0
+}
@@ -0,0 +1,122 @@
+package webrtcsignalingserver
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// EventType names what happened in an Event.
+type EventType string
+
+const (
+	// EventListenerRegistered is sent by AddSDPListener and AddSDPSessionListener
+	EventListenerRegistered EventType = "listener_registered"
+	// EventClientSDPArrived is sent when a client SDP for a listener is accepted,
+	// before it is delivered
+	EventClientSDPArrived EventType = "client_sdp_arrived"
+	// EventSDPStored is sent when /sdp_store keeps an SDP
+	EventSDPStored EventType = "sdp_stored"
+	// EventAnswerSent is sent when a listener's answer goes back to the client
+	EventAnswerSent EventType = "answer_sent"
+	// EventHandshakeTimeout is sent when a handshake outlives the handshake timeout
+	EventHandshakeTimeout EventType = "handshake_timeout"
+	// EventStoredSDPExpired is sent when storage drops an expired SDP, see
+	// ExpiryNotifier
+	EventStoredSDPExpired EventType = "stored_sdp_expired"
+)
+
+// Event is something that happened on a SignalingServer, see Observer.
+type Event struct {
+	Type EventType
+	// Id of the listener or stored SDP
+	Id string
+	// Endpoint the event happened on, e.g. "sdp_inform"; empty outside of
+	// requests
+	Endpoint string
+	// Data of the client SDP, of the answer for EventAnswerSent and of the
+	// stored SDP for EventStoredSDPExpired
+	Data map[string]string
+	// SDP (BASE64) of EventClientSDPArrived and EventSDPStored, as rewritten
+	// by the SDP middleware and the CandidatePolicy
+	SDP string
+	// RemoteAddr and RequestID of the request, empty outside of requests
+	RemoteAddr string
+	RequestID  string
+	Time       time.Time
+	// Duration is how long the client waited for EventAnswerSent and
+	// EventHandshakeTimeout, and how long the SDP was kept for
+	// EventStoredSDPExpired
+	Duration time.Duration
+}
+
+// Observer is told about every Event, see WithObserver. Observers are called
+// one after the other on the goroutine of the event, so they should return
+// quickly; a panicking Observer is recovered and logged.
+type Observer interface {
+	Observe(event *Event)
+}
+
+type ObserverFunc func(event *Event)
+
+func (f ObserverFunc) Observe(event *Event) {
+	f(event)
+}
+
+// ExpiryNotifier is implemented by Storages that can tell when they drop an
+// expired SDP. MemoryStorage does, on every sweep.
+type ExpiryNotifier interface {
+	// NotifyExpired makes notify the one function called for expired SDPs.
+	NotifyExpired(notify func(id string, sdp *StoredSDP))
+}
+
+// newEvent is an Event of request, which is nil outside of requests.
+func newEvent(request *http.Request, eventType EventType, id string, data map[string]string) (event *Event) {
+	event = &Event{Type: eventType, Id: id, Data: data, Time: time.Now()}
+	if request != nil {
+		event.RemoteAddr = request.RemoteAddr
+		event.RequestID = RequestIDFromContext(request.Context())
+		event.Endpoint = endpointFromContext(request.Context())
+	}
+	return
+}
+
+// then is the event of the same handshake that follows e, timed from e.
+func (e *Event) then(eventType EventType) (event *Event) {
+	followed := *e
+	event = &followed
+	event.Type, event.Time, event.SDP = eventType, time.Now(), ""
+	event.Duration = event.Time.Sub(e.Time)
+	return
+}
+
+// observe tells every Observer about event.
+func (ss *SignalingServer) observe(event *Event) {
+	for _, observer := range ss.observers {
+		ss.callObserver(observer, event)
+	}
+}
+
+func (ss *SignalingServer) callObserver(observer Observer, event *Event) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			ss.logger.Error("observer panicked", "event", event.Type, "id", event.Id, "panic", recovered, "stack", string(debug.Stack()))
+		}
+	}()
+
+	observer.Observe(event)
+}
+
+// observeExpiry reports the SDPs storage drops as they expire, if it can.
+func (ss *SignalingServer) observeExpiry() {
+	notifier, ok := ss.storage.(ExpiryNotifier)
+	if !ok {
+		return
+	}
+
+	notifier.NotifyExpired(func(id string, sdp *StoredSDP) {
+		event := newEvent(nil, EventStoredSDPExpired, id, sdp.SDP.Data())
+		event.Duration = sdp.ExpiresAt.Sub(sdp.CreatedAt)
+		ss.observe(event)
+	})
+}
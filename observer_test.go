@@ -0,0 +1,162 @@
+package webrtcsignalingserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSignalingServer_Observer(t *testing.T) {
+	storage := NewMemoryStorage(0)
+	events := make(chan *Event, 16)
+
+	ss := New(
+		WithStorage(storage),
+		WithHandshakeTimeout(50*time.Millisecond),
+		WithObserver(
+			ObserverFunc(func(event *Event) { panic("broken hook") }),
+			ObserverFunc(func(event *Event) { events <- event }),
+		),
+	)
+
+	next := func(want EventType) *Event {
+		t.Helper()
+
+		event := <-events
+		if event.Type != want {
+			t.Fatalf("event = %s, want %s", event.Type, want)
+		}
+		return event
+	}
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := next(EventListenerRegistered); event.Id != "publisher" {
+		t.Errorf("registered event = %+v", event)
+	}
+
+	go func() {
+		if _, err := listener.ReadSDPClientContext(t.Context()); err != nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testOfferSDP}, map[string]string{"server": "sfu-1"})
+	}()
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(`{"id":"publisher","sdp":"`+offer+`","data":{"role":"viewer"}}`))
+	ss.sdpHandShakerHandler(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("handshake with a panicking observer = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	arrived := next(EventClientSDPArrived)
+	if arrived.Id != "publisher" || arrived.Data["role"] != "viewer" || arrived.RemoteAddr != request.RemoteAddr {
+		t.Errorf("arrived event = %+v", arrived)
+	}
+
+	if answered := next(EventAnswerSent); answered.Data["server"] != "sfu-1" || answered.Duration < 5*time.Millisecond {
+		t.Errorf("answer event = %+v", answered)
+	}
+
+	if _, err = ss.AddSDPListener("silent"); err != nil {
+		t.Fatal(err)
+	}
+	next(EventListenerRegistered)
+
+	go func() {
+		// Takes the offer and never answers
+		silent, err := ss.storage.FindSDPListener("silent")
+		if err == nil {
+			silent.ReadSDPClientContext(t.Context())
+		}
+	}()
+
+	recorder = httptest.NewRecorder()
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(`{"id":"silent","sdp":"`+offer+`"}`)))
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Fatalf("unanswered handshake = %d", recorder.Code)
+	}
+
+	next(EventClientSDPArrived)
+	if timeout := next(EventHandshakeTimeout); timeout.Id != "silent" || timeout.Duration < 50*time.Millisecond {
+		t.Errorf("timeout event = %+v", timeout)
+	}
+
+	if err = storage.AddSDPToStorage("stored", offer, map[string]string{"room": "lobby"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	storage.sweep(time.Now().Add(time.Hour))
+
+	if expired := next(EventStoredSDPExpired); expired.Id != "stored" || expired.Data["room"] != "lobby" || expired.Duration != time.Minute {
+		t.Errorf("expired event = %+v", expired)
+	}
+}
+
+func TestSignalingServer_ObserverAfterRewrite(t *testing.T) {
+	events := make(chan *Event, 4)
+	ss := New(
+		WithCandidatePolicy(CandidatePolicy{DropHost: true}),
+		WithObserver(ObserverFunc(func(event *Event) { events <- event })),
+	)
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testVideoOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-events
+
+	go listener.ReadSDPClientContext(t.Context())
+
+	recorder := httptest.NewRecorder()
+	ss.sdpInformListenerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_inform", strings.NewReader(`{"id":"publisher","sdp":"`+offer+`"}`)))
+
+	arrived := <-events
+	sdp, err := DecodeBase64StringToWebrtcSDP(arrived.SDP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arrived.Type != EventClientSDPArrived || strings.Contains(sdp.SDP, "typ host") {
+		t.Errorf("observed %s with SDP\n%s", arrived.Type, sdp.SDP)
+	}
+}
+
+func TestSignalingServer_ObserverUnknownListener(t *testing.T) {
+	events := make(chan *Event, 4)
+	ss := New(WithObserver(ObserverFunc(func(event *Event) { events <- event })))
+
+	offer := testOfferBase64(t)
+
+	for path, handler := range map[string]http.HandlerFunc{
+		"/sdp_handshake": ss.sdpHandShakerHandler,
+		"/sdp_inform":    ss.sdpInformListenerHandler,
+	} {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"id":"nobody","sdp":"`+offer+`"}`)))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s status = %d, want %d", path, recorder.Code, http.StatusNotFound)
+		}
+	}
+
+	select {
+	case event := <-events:
+		t.Errorf("observed %s for a listener that does not exist", event.Type)
+	default:
+	}
+}
@@ -0,0 +1,171 @@
+package webrtcsignalingserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Option func(ss *SignalingServer)
+
+// WithHandshakeTimeout bounds how long a handler waits on a listener.
+// Zero disables the timeout, leaving only the request's own context.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(ss *SignalingServer) {
+		ss.handshakeTimeout = timeout
+	}
+}
+
+// WithStoredSDPTTL sets how long /sdp_store keeps an SDP when the request does
+// not carry its own ttl. Zero keeps entries until they are consumed.
+func WithStoredSDPTTL(ttl time.Duration) Option {
+	return func(ss *SignalingServer) {
+		ss.storedSDPTTL = ttl
+	}
+}
+
+// WithMaxStoredSDPTTL caps the ttl a /sdp_store request may ask for, longer
+// ones are cut to ttl. Zero lets requests keep SDPs as long as they like.
+func WithMaxStoredSDPTTL(ttl time.Duration) Option {
+	return func(ss *SignalingServer) {
+		ss.maxStoredSDPTTL = ttl
+	}
+}
+
+// WithStorage replaces the default MemoryStorage.
+func WithStorage(storage Storage) Option {
+	return func(ss *SignalingServer) {
+		ss.storage = storage
+	}
+}
+
+// WithRoomPeerTimeout sets how long a peer that joined a room over HTTP may go
+// without polling before it is removed. Zero keeps such peers until they leave.
+func WithRoomPeerTimeout(timeout time.Duration) Option {
+	return func(ss *SignalingServer) {
+		ss.rooms.peerTimeout = timeout
+	}
+}
+
+// WithAuthenticator rejects requests to every endpoint unless authenticator
+// accepts them.
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(ss *SignalingServer) {
+		ss.authenticator = authenticator
+	}
+}
+
+// WithIPRateLimit limits the requests of each remote IP, to every endpoint.
+// A non-positive Rate or Burst disables the limit.
+func WithIPRateLimit(limit RateLimit) Option {
+	return func(ss *SignalingServer) {
+		ss.ipLimiter = newRateLimiter(limit)
+	}
+}
+
+// WithIDRateLimit limits the requests naming each listener, stored SDP or
+// room id, whoever makes them. A non-positive Rate or Burst disables the limit.
+func WithIDRateLimit(limit RateLimit) Option {
+	return func(ss *SignalingServer) {
+		ss.idLimiter = newRateLimiter(limit)
+	}
+}
+
+// WithMaxPendingHandshakes caps the handshakes, informs, websocket sessions and
+// websocket offers waiting on listeners at once. Zero is unlimited.
+func WithMaxPendingHandshakes(max int) Option {
+	return func(ss *SignalingServer) {
+		ss.maxPendingHandshakes = max
+	}
+}
+
+// WithMaxStoredSDPs caps how many SDPs /sdp_store keeps at once. Zero is
+// unlimited.
+func WithMaxStoredSDPs(max int) Option {
+	return func(ss *SignalingServer) {
+		ss.maxStoredSDPs = max
+	}
+}
+
+// WithTLSConfig makes Start serve TLS with config, which has to provide a
+// certificate. ListenTLS uses it too, for everything but the certificate.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(ss *SignalingServer) {
+		ss.tlsConfig = config
+	}
+}
+
+// WithClientCertificates verifies the client certificates sent over TLS
+// against clientCAs. Clients without one are still let in; use
+// ClientCertAuthenticator to require it.
+func WithClientCertificates(clientCAs *x509.CertPool) Option {
+	return func(ss *SignalingServer) {
+		ss.clientCAs = clientCAs
+	}
+}
+
+// WithSDPMiddleware rewrites every client SDP before it is delivered to a
+// listener and every answer before it is sent back, by middleware in order.
+// Calling it again adds to the chain.
+func WithSDPMiddleware(middleware ...SDPMiddleware) Option {
+	return func(ss *SignalingServer) {
+		ss.sdpMiddleware = append(ss.sdpMiddleware, middleware...)
+	}
+}
+
+// WithCandidatePolicy drops the ICE candidates policy refuses from SDPs and
+// trickled candidates, both ways. FilteredCandidates counts what was dropped.
+func WithCandidatePolicy(policy CandidatePolicy) Option {
+	return func(ss *SignalingServer) {
+		ss.candidatePolicy = &policy
+	}
+}
+
+// WithMetrics registers the server's Prometheus collectors with registerer
+// and serves them on /metrics. When nil, the server gets a registry of its
+// own with the Go and process collectors. The registerer is gathered from as
+// well when it is a prometheus.Gatherer, like *prometheus.Registry;
+// prometheus.DefaultGatherer is served otherwise.
+func WithMetrics(registerer prometheus.Registerer) Option {
+	return func(ss *SignalingServer) {
+		ss.metrics = newMetrics(ss, registerer)
+	}
+}
+
+// WithLogger logs every stage of a request to logger: the request parsed, the
+// listener found or consumed, the client SDP delivered, the server SDP
+// returned and errors. Nothing is logged without it.
+func WithLogger(logger *slog.Logger) Option {
+	return func(ss *SignalingServer) {
+		ss.logger = logger
+	}
+}
+
+// WithTracerProvider traces requests with a tracer of provider instead of the
+// global one, see otel.SetTracerProvider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(ss *SignalingServer) {
+		ss.tracer = newTracer(provider)
+	}
+}
+
+// WithAdmin serves the /admin endpoints to whoever authenticator accepts. It
+// is consulted instead of the one of WithAuthenticator, so it should accept
+// operators only, e.g. a BearerAuthenticator with tokens of their own.
+func WithAdmin(authenticator Authenticator) Option {
+	return func(ss *SignalingServer) {
+		ss.adminAuthenticator = authenticator
+	}
+}
+
+// WithObserver tells observers about every Event, in the order given. Expired
+// stored SDPs are reported when storage is an ExpiryNotifier.
+func WithObserver(observers ...Observer) Option {
+	return func(ss *SignalingServer) {
+		ss.observers = append(ss.observers, observers...)
+	}
+}
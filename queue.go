@@ -0,0 +1,108 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"sync"
+)
+
+// queue buffers values until the other side reads or polls them, so neither
+// side has to wait for the other to be ready.
+type queue[T any] struct {
+	pending []T
+	ready   chan struct{}
+
+	m sync.Mutex
+}
+
+func newQueue[T any]() *queue[T] {
+	return &queue[T]{ready: make(chan struct{}, 1)}
+}
+
+func (q *queue[T]) push(value T) {
+	q.m.Lock()
+	q.pending = append(q.pending, value)
+	q.m.Unlock()
+
+	q.signal()
+}
+
+// pushBounded is push unless max values are pending already.
+func (q *queue[T]) pushBounded(value T, max int) (ok bool) {
+	q.m.Lock()
+	if len(q.pending) >= max {
+		q.m.Unlock()
+		return false
+	}
+	q.pending = append(q.pending, value)
+	q.m.Unlock()
+
+	q.signal()
+	return true
+}
+
+func (q *queue[T]) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue[T]) tryPop() (value T, ok bool) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if len(q.pending) == 0 {
+		return
+	}
+
+	value, ok = q.pending[0], true
+	q.pending = q.pending[1:]
+
+	if len(q.pending) > 0 {
+		q.signal()
+	}
+
+	return
+}
+
+// popContext waits for a value until ctx or done is; values pushed before
+// are still returned after done.
+func (q *queue[T]) popContext(ctx context.Context, done <-chan struct{}) (value T, ok bool, err error) {
+	for {
+		if value, ok = q.tryPop(); ok {
+			return
+		}
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-done:
+			// Pushed right before done was closed
+			value, ok = q.tryPop()
+			return
+		}
+	}
+}
+
+func (q *queue[T]) len() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	return len(q.pending)
+}
+
+func (q *queue[T]) drain() (values []T) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	values = q.pending
+	q.pending = nil
+
+	if values == nil {
+		values = []T{}
+	}
+
+	return
+}
@@ -0,0 +1,226 @@
+package webrtcsignalingserver
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// capacityRetryAfter is what clients are told to wait when a global cap is hit.
+const capacityRetryAfter = time.Second
+
+// storedSDPCountInterval is how long a count of the stored SDPs is trusted.
+const storedSDPCountInterval = time.Second
+
+// RateLimit is a token bucket: Burst requests at once, refilled at Rate per
+// second.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimiter struct {
+	limit   RateLimit
+	buckets map[string]*bucket
+
+	lastPrune time.Time
+
+	m sync.Mutex
+}
+
+// newRateLimiter returns nil, no limit, unless limit allows some requests.
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Rate <= 0 || limit.Burst <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{limit: limit, buckets: map[string]*bucket{}}
+}
+
+// allow takes a token from the bucket of key, or tells how long until one is
+// available.
+func (rl *rateLimiter) allow(key string, now time.Time) (ok bool, retryAfter time.Duration) {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+
+	rl.prune(now)
+
+	b, exists := rl.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(rl.limit.Burst), updated: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(rl.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*rl.limit.Rate)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+		return
+	}
+
+	retryAfter = time.Duration((1 - b.tokens) / rl.limit.Rate * float64(time.Second))
+	return
+}
+
+// prune forgets buckets that refilled completely, they are the same as new
+// ones. Runs at most once per refill period so allow stays cheap.
+func (rl *rateLimiter) prune(now time.Time) {
+	refill := time.Duration(float64(rl.limit.Burst) / rl.limit.Rate * float64(time.Second))
+	if now.Sub(rl.lastPrune) < refill {
+		return
+	}
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(rl.buckets, key)
+		}
+	}
+
+	rl.lastPrune = now
+}
+
+func tooManyRequests(writer http.ResponseWriter, retryAfter time.Duration, err error) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	writer.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(writer, err)
+}
+
+func remoteIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+
+	return host
+}
+
+// limitIP runs the per IP limit in front of handler, if there is one.
+func (ss *SignalingServer) limitIP(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if ss.ipLimiter != nil {
+			if ok, retryAfter := ss.ipLimiter.allow(remoteIP(request), time.Now()); !ok {
+				tooManyRequests(writer, retryAfter, ErrRateLimited)
+				return
+			}
+		}
+
+		handler(writer, request)
+	}
+}
+
+// limitID writes a 429 and returns false when id is over its limit.
+func (ss *SignalingServer) limitID(writer http.ResponseWriter, id string) bool {
+	if ss.idLimiter == nil {
+		return true
+	}
+
+	ok, retryAfter := ss.idLimiter.allow(id, time.Now())
+	if !ok {
+		tooManyRequests(writer, retryAfter, ErrRateLimited)
+	}
+
+	return ok
+}
+
+// acquireHandshake counts a handshake as pending until release is called. It
+// writes the response and returns false when too many are, or when the server
+// is shutting down.
+func (ss *SignalingServer) acquireHandshake(writer http.ResponseWriter) (release func(), ok bool) {
+	release, err := ss.reserveHandshake()
+	switch err {
+	case nil:
+		ok = true
+	case ErrTooManyPendingHandshakes:
+		tooManyRequests(writer, capacityRetryAfter, err)
+	default:
+		writeError(writer, err)
+	}
+
+	return
+}
+
+// reserveHandshake is acquireHandshake without a response, for websocket
+// offers; it fails with ErrTooManyPendingHandshakes or ErrServerShutdown.
+func (ss *SignalingServer) reserveHandshake() (release func(), err error) {
+	ss.pendingM.Lock()
+	defer ss.pendingM.Unlock()
+
+	if ss.maxPendingHandshakes > 0 && ss.pendingHandshakes >= ss.maxPendingHandshakes {
+		err = ErrTooManyPendingHandshakes
+		return
+	}
+
+	if !ss.beginHandshake() {
+		err = ErrServerShutdown
+		return
+	}
+
+	ss.pendingHandshakes++
+
+	release = func() {
+		ss.pendingM.Lock()
+		ss.pendingHandshakes--
+		ss.pendingM.Unlock()
+
+		ss.lifecycle.inFlight.Done()
+	}
+	return
+}
+
+// reserveStoredSDP takes one of the maxStoredSDPs slots for a store until
+// release is called, with whether the SDP was stored. It writes the response
+// and returns false when every slot is taken or storage cannot be counted.
+// Storage is listed at most once per storedSDPCountInterval; in between, the
+// count only grows with the SDPs stored here.
+func (ss *SignalingServer) reserveStoredSDP(writer http.ResponseWriter) (release func(stored bool), ok bool) {
+	if ss.maxStoredSDPs <= 0 {
+		release, ok = func(bool) {}, true
+		return
+	}
+
+	ss.storedM.Lock()
+	defer ss.storedM.Unlock()
+
+	now := time.Now()
+	if now.Sub(ss.storedSDPsCountedAt) >= storedSDPCountInterval {
+		ids, err := ss.storage.ListSDPsInStorage()
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+
+		ss.storedSDPs, ss.storedSDPsCountedAt = len(ids), now
+	}
+
+	if ss.storedSDPs+ss.reservedSDPs >= ss.maxStoredSDPs {
+		tooManyRequests(writer, capacityRetryAfter, ErrStorageFull)
+		return
+	}
+
+	ss.reservedSDPs++
+
+	release = func(stored bool) {
+		ss.storedM.Lock()
+		ss.reservedSDPs--
+		if stored {
+			ss.storedSDPs++
+		}
+		ss.storedM.Unlock()
+	}
+	ok = true
+	return
+}
@@ -0,0 +1,201 @@
+package webrtcsignalingserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(RateLimit{Rate: 2, Burst: 2})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := rl.allow("a", now); !ok {
+			t.Fatalf("allow() call %d within burst rejected", i+1)
+		}
+	}
+
+	ok, retryAfter := rl.allow("a", now)
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Errorf("allow() over burst = %v, %v, want false, 500ms", ok, retryAfter)
+	}
+
+	if ok, _ = rl.allow("b", now); !ok {
+		t.Error("allow() of another key rejected")
+	}
+
+	if ok, _ = rl.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("allow() after a refill rejected")
+	}
+
+	if ok, _ = rl.allow("a", now.Add(time.Hour)); !ok || len(rl.buckets) != 1 {
+		t.Errorf("allow() after idling = %v with %d buckets, want idle buckets pruned", ok, len(rl.buckets))
+	}
+
+	if newRateLimiter(RateLimit{}) != nil {
+		t.Error("newRateLimiter() of a zero limit is not disabled")
+	}
+}
+
+func TestSignalingServer_RateLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []Option
+		prepare  func(t *testing.T, ss *SignalingServer)
+		path     string
+		requests int
+	}{
+		{
+			name:     "ip",
+			options:  []Option{WithIPRateLimit(RateLimit{Rate: 0.1, Burst: 2})},
+			path:     "/sdp_fetch?id=missing",
+			requests: 2,
+		},
+		{
+			name:     "id",
+			options:  []Option{WithIDRateLimit(RateLimit{Rate: 0.1, Burst: 1})},
+			path:     "/sdp_fetch?id=missing",
+			requests: 1,
+		},
+		{
+			name:    "stored_sdps",
+			options: []Option{WithMaxStoredSDPs(1)},
+			prepare: func(t *testing.T, ss *SignalingServer) {
+				if err := ss.storage.AddSDPToStorage("first", testOfferBase64(t), nil, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			},
+			path: "/sdp_store",
+		},
+		{
+			name:    "pending_handshakes",
+			options: []Option{WithMaxPendingHandshakes(1)},
+			prepare: func(t *testing.T, ss *SignalingServer) {
+				listener, err := ss.AddSDPListener("other")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Keeps one handshake pending until the test ends
+				go ss.sdpHandShakerHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/sdp_handshake",
+					strings.NewReader(`{"id":"other","sdp":"`+testOfferBase64(t)+`"}`)))
+				listener.ReadClientSDP()
+				t.Cleanup(func() {
+					listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}, nil)
+				})
+			},
+			path: "/sdp_handshake",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := New(tt.options...)
+
+			m := http.NewServeMux()
+			ss.register(m)
+
+			if tt.prepare != nil {
+				tt.prepare(t, ss)
+			}
+
+			do := func() *httptest.ResponseRecorder {
+				body := `{"id":"publisher","sdp":"` + testOfferBase64(t) + `"}`
+				method := http.MethodPost
+				if strings.HasPrefix(tt.path, "/sdp_fetch") {
+					method = http.MethodGet
+				}
+
+				recorder := httptest.NewRecorder()
+				m.ServeHTTP(recorder, httptest.NewRequest(method, tt.path, strings.NewReader(body)))
+				return recorder
+			}
+
+			for i := 0; i < tt.requests; i++ {
+				if recorder := do(); recorder.Code == http.StatusTooManyRequests {
+					t.Fatalf("request %d within the limit rejected", i+1)
+				}
+			}
+
+			recorder := do()
+			if recorder.Code != http.StatusTooManyRequests {
+				t.Fatalf("status = %d %s, want %d", recorder.Code, recorder.Body.String(), http.StatusTooManyRequests)
+			}
+
+			if recorder.Header().Get("Retry-After") == "" {
+				t.Error("429 without Retry-After")
+			}
+		})
+	}
+}
+
+// listFailingStorage cannot list its SDPs
+type listFailingStorage struct {
+	Storage
+}
+
+func (s *listFailingStorage) ListSDPsInStorage() (ids []string, err error) {
+	err = errors.New("storage unreachable")
+	return
+}
+
+func TestSignalingServer_StoredSDPCapacity(t *testing.T) {
+	const max = 3
+
+	ss := New(WithMaxStoredSDPs(max), WithMaxStoredSDPTTL(time.Hour))
+	store := func(id string, ttl int) *httptest.ResponseRecorder {
+		body := `{"id":"` + id + `","sdp":"` + testOfferBase64(t) + `","ttl":` + strconv.Itoa(ttl) + `}`
+		recorder := httptest.NewRecorder()
+		ss.sdpStoreHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_store", strings.NewReader(body)))
+		return recorder
+	}
+
+	// Stores racing for the last slots do not overshoot
+	var (
+		stored int
+		m      sync.Mutex
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if store("racer-"+strconv.Itoa(i), 0).Code == http.StatusOK {
+				m.Lock()
+				stored++
+				m.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if ids, _ := ss.storage.ListSDPsInStorage(); stored != max || len(ids) != max {
+		t.Errorf("%d stores succeeded, %d SDPs stored, want %d", stored, len(ids), max)
+	}
+
+	// A huge ttl is cut to the maximum
+	ss = New(WithMaxStoredSDPTTL(time.Hour))
+	if recorder := store("forever", 1<<62); recorder.Code != http.StatusOK {
+		t.Fatalf("store status = %d %s", recorder.Code, recorder.Body.String())
+	}
+	sdp, err := ss.storage.GetSDPFromStorage("forever")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := sdp.ExpiresAt.Sub(sdp.CreatedAt); ttl != time.Hour {
+		t.Errorf("ttl = %s, want %s", ttl, time.Hour)
+	}
+
+	// Failing to count is the server's fault, not a full storage
+	ss = New(WithMaxStoredSDPs(max), WithStorage(&listFailingStorage{Storage: NewMemoryStorage(0)}))
+	if recorder := store("publisher", 0); recorder.Code != http.StatusInternalServerError {
+		t.Errorf("store status with a failing storage = %d %s, want %d", recorder.Code, recorder.Body.String(), http.StatusInternalServerError)
+	}
+}
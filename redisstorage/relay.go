@@ -0,0 +1,240 @@
+package redisstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/redis/go-redis/v9"
+)
+
+type relayKind string
+
+const (
+	relayRequest relayKind = "request"
+	// A request of /sdp_inform, nobody waits for its answer
+	relayInform relayKind = "inform"
+	// The owner's listener took the client SDP, the reply follows unless it
+	// was informed
+	relayAccepted relayKind = "accepted"
+	relayReply    relayKind = "reply"
+)
+
+type relayMessage struct {
+	Kind      relayKind         `json:"kind"`
+	RequestID string            `json:"request_id"`
+	ReplyTo   string            `json:"reply_to,omitempty"`
+	Id        string            `json:"id,omitempty"`
+	SDP       string            `json:"sdp,omitempty"` // BASE64
+	Data      map[string]string `json:"data,omitempty"`
+	SessionId string            `json:"session_id,omitempty"`
+	Error     string            `json:"error,omitempty"`
+
+	Principal *webrtcsignalingserver.Principal `json:"principal,omitempty"`
+}
+
+func (s *Storage) publish(nodeID string, message *relayMessage) (receivers int64, err error) {
+	var payload []byte
+	payload, err = json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	receivers, err = s.client.Publish(ctx, s.nodeChannel(nodeID), payload).Result()
+	return
+}
+
+func (s *Storage) relayLoop(messages <-chan *redis.Message) {
+	for m := range messages {
+		var message *relayMessage
+		if err := json.Unmarshal([]byte(m.Payload), &message); err != nil || message == nil {
+			continue
+		}
+
+		switch message.Kind {
+		case relayRequest, relayInform:
+			go s.answerRelayedRequest(message)
+		case relayAccepted, relayReply:
+			s.pendingM.Lock()
+			reply, exists := s.pending[message.RequestID]
+			s.pendingM.Unlock()
+
+			if exists {
+				reply <- message
+			}
+		}
+	}
+}
+
+// relayToOwner plays the owner of a stand-in listener: it forwards whatever
+// the handler writes to the owner node, acknowledges it once the owner's
+// listener took it and writes the answer back, unless it was informed.
+func (s *Storage) relayToOwner(owner, id string, l *webrtcsignalingserver.Listener) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.relayTimeout)
+	defer cancel()
+
+	clientSDP, err := l.ReadSDPClientContext(ctx)
+	if err != nil {
+		l.Close(err)
+		return
+	}
+
+	requestID, err := newID()
+	if err != nil {
+		l.Close(err)
+		return
+	}
+
+	kind := relayRequest
+	if clientSDP.Informed() {
+		kind = relayInform
+	}
+
+	request := &relayMessage{
+		Kind:      kind,
+		RequestID: requestID,
+		ReplyTo:   s.nodeID,
+		Id:        id,
+		SDP:       clientSDP.Base64(),
+		Data:      clientSDP.Data(),
+		Principal: clientSDP.Principal(),
+	}
+
+	// Room for the acceptance and the reply
+	reply := make(chan *relayMessage, 2)
+
+	s.pendingM.Lock()
+	s.pending[request.RequestID] = reply
+	s.pendingM.Unlock()
+
+	defer func() {
+		s.pendingM.Lock()
+		delete(s.pending, request.RequestID)
+		s.pendingM.Unlock()
+	}()
+
+	var receivers int64
+	receivers, err = s.publish(owner, request)
+	if err == nil && receivers == 0 {
+		// The owner is gone without releasing its ids
+		err = webrtcsignalingserver.ErrListenerNotFound
+	}
+
+	if err != nil {
+		l.Close(err)
+		return
+	}
+
+	var answer *relayMessage
+	for answer == nil {
+		select {
+		case message := <-reply:
+			if message.Kind == relayAccepted {
+				l.AckClientSDP(nil)
+				if kind == relayInform {
+					return
+				}
+				continue
+			}
+			answer = message
+		case <-ctx.Done():
+			l.Close(ctx.Err())
+			return
+		case <-s.stop:
+			l.Close(webrtcsignalingserver.ErrStorageClosed)
+			return
+		}
+	}
+
+	if answer.Error != "" {
+		l.Close(relayedError(answer.Error))
+		return
+	}
+
+	sdp, err := webrtcsignalingserver.DecodeBase64StringToWebrtcSDP(answer.SDP)
+	if err != nil {
+		l.Close(err)
+		return
+	}
+
+	serverSDP, err := webrtcsignalingserver.NewServerSDP(sdp, answer.Data)
+	if err != nil {
+		l.Close(err)
+		return
+	}
+	serverSDP.SessionId = answer.SessionId
+
+	l.WriteSDPServerContext(ctx, serverSDP)
+}
+
+// answerRelayedRequest delivers a relayed client SDP to the local listener,
+// tells the node holding the HTTP request once it was taken and sends the
+// answer back. Informs are done once taken.
+func (s *Storage) answerRelayedRequest(request *relayMessage) {
+	reply := &relayMessage{Kind: relayReply, RequestID: request.RequestID}
+	defer s.publish(request.ReplyTo, reply)
+
+	l, err := s.local.GetSDPListener(request.Id)
+	if err != nil {
+		reply.Error = err.Error()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.relayTimeout)
+	defer cancel()
+
+	if request.Principal != nil {
+		ctx = webrtcsignalingserver.ContextWithPrincipal(ctx, request.Principal)
+	}
+
+	answers, err := l.DeliverClientSDPContext(ctx, request.SDP, request.Data)
+	if err != nil {
+		if answers != nil {
+			answers.Close(err)
+		}
+		reply.Error = err.Error()
+		return
+	}
+
+	if request.Kind == relayInform {
+		reply.Kind = relayAccepted
+		return
+	}
+
+	s.publish(request.ReplyTo, &relayMessage{Kind: relayAccepted, RequestID: request.RequestID})
+
+	serverSDP, err := answers.ReadServerSDPContext(ctx)
+	if err == context.DeadlineExceeded {
+		err = webrtcsignalingserver.ErrHandshakeTimeout
+	}
+
+	if err != nil {
+		reply.Error = err.Error()
+		return
+	}
+
+	reply.SDP, reply.Data, reply.SessionId = serverSDP.Base64(), serverSDP.Data, serverSDP.SessionId
+}
+
+// relayedError turns the text of an error relayed by another node back into
+// an error errors.Is recognizes, if it starts with a known code.
+func relayedError(text string) error {
+	code, _, _ := strings.Cut(text, ":")
+
+	e, ok := webrtcsignalingserver.ErrorForCode(webrtcsignalingserver.ErrorCode(code))
+	if !ok {
+		return errors.New(text)
+	}
+
+	if code == text {
+		return e
+	}
+
+	return fmt.Errorf("%w%s", e, strings.TrimPrefix(text, code))
+}
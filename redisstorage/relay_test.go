@@ -0,0 +1,64 @@
+package redisstorage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/aliforever/go-webrtc-signaling-server/storagetest"
+	"github.com/pion/webrtc/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStorage_RelayInformDone(t *testing.T) {
+	m := miniredis.RunT(t)
+
+	newNode := func(nodeID string) *Storage {
+		client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+		t.Cleanup(func() { client.Close() })
+
+		s, err := New(client, WithNodeID(nodeID), WithRelayTimeout(5*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+
+	owner, other := newNode("owner"), newNode("other")
+
+	listener, err := owner.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go listener.ReadSDPClientContext(t.Context())
+
+	offer, _ := webrtcsignalingserver.EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: storagetest.OfferSDP})
+
+	ss := webrtcsignalingserver.New(webrtcsignalingserver.WithStorage(other))
+	recorder := httptest.NewRecorder()
+	ss.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/sdp_inform", strings.NewReader(`{"id":"publisher","sdp":"`+offer+`"}`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("relayed inform = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Nothing waits for an answer, well before the relay timeout
+	deadline := time.Now().Add(time.Second)
+	for {
+		other.pendingM.Lock()
+		pending := len(other.pending)
+		other.pendingM.Unlock()
+
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d relays still wait for the answer of an inform", pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,461 @@
+// Package redisstorage keeps stored SDPs in Redis and relays handshakes over
+// Redis pub/sub, so several signaling servers can sit behind one load balancer.
+//
+// Listeners still live in the process that registered them. Redis only records
+// which node owns an id; a handshake that lands on another node is relayed to
+// the owner and its answer is routed back to the waiting request.
+// Trickled candidates are not relayed, /sdp_candidate has to reach the owner.
+package redisstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultPrefix       = "webrtcsignaling"
+	DefaultRelayTimeout = 30 * time.Second
+
+	// Appended to the owner of ids held by session listeners, which are never consumed
+	sessionOwnerSuffix = "+sessions"
+
+	listenerKeyTTL          = 30 * time.Second
+	listenerRefreshInterval = 10 * time.Second
+	commandTimeout          = 5 * time.Second
+)
+
+// Deletes or expires KEYS[1] only while it still holds ARGV[1], so a node
+// never touches an id another node registered since.
+var (
+	compareAndDelete = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	compareAndExpire = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	// Returns the owner of KEYS[1], consuming the key unless it ends with ARGV[1]
+	claimListener = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if not owner then
+	return false
+end
+if string.sub(owner, -string.len(ARGV[1])) ~= ARGV[1] then
+	redis.call("DEL", KEYS[1])
+end
+return owner`)
+)
+
+type Storage struct {
+	client redis.UniversalClient
+	local  *webrtcsignalingserver.MemoryStorage
+
+	prefix       string
+	nodeID       string
+	relayTimeout time.Duration
+
+	pubsub   *redis.PubSub
+	pending  map[string]chan *relayMessage
+	pendingM sync.Mutex
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+type Option func(s *Storage)
+
+// WithPrefix namespaces every key and channel, so several deployments can
+// share one Redis.
+func WithPrefix(prefix string) Option {
+	return func(s *Storage) {
+		s.prefix = prefix
+	}
+}
+
+// WithNodeID names this node on the relay. It defaults to a random id and
+// must be unique across the deployment.
+func WithNodeID(nodeID string) Option {
+	return func(s *Storage) {
+		s.nodeID = nodeID
+	}
+}
+
+// WithRelayTimeout bounds how long a relayed handshake waits for the owner.
+func WithRelayTimeout(timeout time.Duration) Option {
+	return func(s *Storage) {
+		s.relayTimeout = timeout
+	}
+}
+
+// New subscribes to the relay channel of this node. The client is not closed
+// by Close, it belongs to the caller.
+func New(client redis.UniversalClient, options ...Option) (s *Storage, err error) {
+	s = &Storage{
+		client:       client,
+		local:        webrtcsignalingserver.NewMemoryStorage(0),
+		prefix:       DefaultPrefix,
+		relayTimeout: DefaultRelayTimeout,
+		pending:      map[string]chan *relayMessage{},
+		stop:         make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	if s.nodeID == "" {
+		if s.nodeID, err = newID(); err != nil {
+			s.local.Close()
+			s = nil
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	s.pubsub = client.Subscribe(ctx, s.nodeChannel(s.nodeID))
+	if _, err = s.pubsub.Receive(ctx); err != nil {
+		s.pubsub.Close()
+		s = nil
+		return
+	}
+
+	go s.relayLoop(s.pubsub.Channel())
+	go s.keepListenersAlive()
+
+	return
+}
+
+func (s *Storage) NodeID() string {
+	return s.nodeID
+}
+
+func (s *Storage) sdpKey(id string) string {
+	return s.prefix + ":sdp:" + id
+}
+
+func (s *Storage) listenerKey(id string) string {
+	return s.prefix + ":listener:" + id
+}
+
+func (s *Storage) nodeChannel(nodeID string) string {
+	return s.prefix + ":node:" + nodeID
+}
+
+func (s *Storage) AddSDPListener(id string) (l *webrtcsignalingserver.Listener, err error) {
+	l, err = s.local.AddSDPListener(id)
+	if err != nil {
+		return
+	}
+
+	err = s.claim(id, l)
+	if err != nil {
+		l = nil
+	}
+
+	return
+}
+
+func (s *Storage) AddSDPSessionListener(id string) (l *webrtcsignalingserver.Listener, err error) {
+	l, err = s.local.AddSDPSessionListener(id)
+	if err != nil {
+		return
+	}
+
+	err = s.claim(id, l)
+	if err != nil {
+		l = nil
+	}
+
+	return
+}
+
+func (s *Storage) claim(id string, l *webrtcsignalingserver.Listener) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var claimed bool
+	claimed, err = s.client.SetNX(ctx, s.listenerKey(id), s.owner(l), listenerKeyTTL).Result()
+	if err == nil && !claimed {
+		err = webrtcsignalingserver.ErrListenerExists
+	}
+
+	if err != nil {
+		s.local.RemoveSDPListener(id)
+	}
+
+	return
+}
+
+// owner is the value of the listener key of l.
+func (s *Storage) owner(l *webrtcsignalingserver.Listener) string {
+	if l.IsSessionListener() {
+		return s.nodeID + sessionOwnerSuffix
+	}
+
+	return s.nodeID
+}
+
+// localOwner is the value of the listener key of id if this node registered it.
+func (s *Storage) localOwner(id string) string {
+	if l, err := s.local.FindSDPListener(id); err == nil {
+		return s.owner(l)
+	}
+
+	return s.nodeID
+}
+
+// GetSDPListener claims id cluster wide. When another node owns it, the
+// returned listener relays the client SDP to that node and delivers its answer.
+func (s *Storage) GetSDPListener(id string) (l *webrtcsignalingserver.Listener, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var owner string
+	owner, err = claimListener.Run(ctx, s.client, []string{s.listenerKey(id)}, sessionOwnerSuffix).Text()
+	if err == redis.Nil {
+		err = webrtcsignalingserver.ErrListenerNotFound
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	owner = strings.TrimSuffix(owner, sessionOwnerSuffix)
+
+	if owner == s.nodeID {
+		l, err = s.local.GetSDPListener(id)
+		return
+	}
+
+	l = webrtcsignalingserver.NewRelayListener()
+	go s.relayToOwner(owner, id, l)
+
+	return
+}
+
+func (s *Storage) FindSDPListener(id string) (l *webrtcsignalingserver.Listener, err error) {
+	l, err = s.local.FindSDPListener(id)
+	return
+}
+
+func (s *Storage) RemoveSDPListener(id string) (err error) {
+	owner := s.localOwner(id)
+
+	err = s.local.RemoveSDPListener(id)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	err = compareAndDelete.Run(ctx, s.client, []string{s.listenerKey(id)}, owner).Err()
+	return
+}
+
+// ListSDPListeners lists the listeners registered on this node only.
+func (s *Storage) ListSDPListeners() (ids []string, err error) {
+	ids, err = s.local.ListSDPListeners()
+	return
+}
+
+func decodeSDPRecord(payload string) (sdp *webrtcsignalingserver.StoredSDP, err error) {
+	var record *webrtcsignalingserver.SDPRecord
+	err = json.Unmarshal([]byte(payload), &record)
+	if err != nil {
+		return
+	}
+
+	sdp, err = record.StoredSDP()
+	return
+}
+
+func (s *Storage) AddSDPToStorage(id, sdp string, data map[string]string, ttl time.Duration) (err error) {
+	_, err = webrtcsignalingserver.NewClientSDP(sdp, data)
+	if err != nil {
+		return
+	}
+
+	record := &webrtcsignalingserver.SDPRecord{SDP: sdp, Data: data, CreatedAt: time.Now()}
+	if ttl > 0 {
+		record.ExpiresAt = record.CreatedAt.Add(ttl)
+	}
+
+	var payload []byte
+	payload, err = json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var added bool
+	added, err = s.client.SetNX(ctx, s.sdpKey(id), payload, ttl).Result()
+	if err == nil && !added {
+		err = webrtcsignalingserver.ErrSDPExists
+	}
+
+	return
+}
+
+func (s *Storage) GetSDPFromStorage(id string) (sdp *webrtcsignalingserver.StoredSDP, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var payload string
+	payload, err = s.client.Get(ctx, s.sdpKey(id)).Result()
+	if err == redis.Nil {
+		err = webrtcsignalingserver.ErrSDPNotFound
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	sdp, err = decodeSDPRecord(payload)
+	return
+}
+
+func (s *Storage) ConsumeSDPFromStorage(id string) (sdp *webrtcsignalingserver.StoredSDP, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var payload string
+	payload, err = s.client.GetDel(ctx, s.sdpKey(id)).Result()
+	if err == redis.Nil {
+		err = webrtcsignalingserver.ErrSDPNotFound
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	sdp, err = decodeSDPRecord(payload)
+	return
+}
+
+func (s *Storage) DeleteSDPFromStorage(id string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var deleted int64
+	deleted, err = s.client.Del(ctx, s.sdpKey(id)).Result()
+	if err == nil && deleted == 0 {
+		err = webrtcsignalingserver.ErrSDPNotFound
+	}
+
+	return
+}
+
+func (s *Storage) ListSDPsInStorage() (ids []string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	prefix := s.sdpKey("")
+	ids = []string{}
+
+	iter := s.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		ids = append(ids, strings.TrimPrefix(iter.Val(), prefix))
+	}
+
+	if err = iter.Err(); err != nil {
+		ids = nil
+		return
+	}
+
+	sort.Strings(ids)
+	return
+}
+
+func (s *Storage) ImportSDPToStorage(id string, sdp *webrtcsignalingserver.StoredSDP) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var ttl time.Duration
+	if !sdp.ExpiresAt.IsZero() {
+		ttl = time.Until(sdp.ExpiresAt)
+		if ttl <= 0 {
+			err = s.client.Del(ctx, s.sdpKey(id)).Err()
+			return
+		}
+	}
+
+	var payload []byte
+	payload, err = json.Marshal(sdp.Record(""))
+	if err != nil {
+		return
+	}
+
+	err = s.client.Set(ctx, s.sdpKey(id), payload, ttl).Err()
+	return
+}
+
+// Close releases the ids owned by this node and stops relaying.
+func (s *Storage) Close() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		ids, _ := s.local.ListSDPListeners()
+		for _, id := range ids {
+			compareAndDelete.Run(ctx, s.client, []string{s.listenerKey(id)}, s.localOwner(id))
+		}
+
+		err = s.pubsub.Close()
+		s.local.Close()
+	})
+	return
+}
+
+// keepListenersAlive refreshes the ids owned by this node, so ids of a node
+// that died without Close expire instead of pointing nowhere forever.
+func (s *Storage) keepListenersAlive() {
+	ticker := time.NewTicker(listenerRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ids, _ := s.local.ListSDPListeners()
+
+			ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+			for _, id := range ids {
+				compareAndExpire.Run(ctx, s.client, []string{s.listenerKey(id)}, s.localOwner(id), listenerKeyTTL.Milliseconds())
+			}
+			cancel()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func newID() (id string, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	id = hex.EncodeToString(b)
+	return
+}
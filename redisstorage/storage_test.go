@@ -0,0 +1,173 @@
+package redisstorage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/aliforever/go-webrtc-signaling-server/redisstorage"
+	"github.com/aliforever/go-webrtc-signaling-server/storagetest"
+	"github.com/pion/webrtc/v3"
+	"github.com/redis/go-redis/v9"
+)
+
+// runMiniredis lets keys expire in wall clock time like a real Redis would.
+func runMiniredis(t *testing.T) *miniredis.Miniredis {
+	m := miniredis.RunT(t)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.FastForward(10 * time.Millisecond)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return m
+}
+
+func newStorage(t *testing.T, m *miniredis.Miniredis, options ...redisstorage.Option) *redisstorage.Storage {
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	s, err := redisstorage.New(client, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) webrtcsignalingserver.Storage {
+		return newStorage(t, runMiniredis(t))
+	})
+}
+
+func TestStorage_RelayHandshake(t *testing.T) {
+	m := runMiniredis(t)
+
+	owner := newStorage(t, m, redisstorage.WithNodeID("owner"))
+	defer owner.Close()
+
+	other := newStorage(t, m, redisstorage.WithNodeID("other"), redisstorage.WithRelayTimeout(5*time.Second))
+	defer other.Close()
+
+	listener, err := owner.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = other.AddSDPListener("publisher"); err == nil {
+		t.Fatal("AddSDPListener() on another node claimed an owned id")
+	}
+
+	go func() {
+		sdp, data, err := listener.ReadClientSDPContext(testContext(t))
+		if err != nil || sdp.Type != webrtc.SDPTypeOffer || data["k"] != "v" {
+			t.Errorf("owner read = %v, %v, %v", sdp, data, err)
+			return
+		}
+
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}, map[string]string{"from": "owner"})
+	}()
+
+	// What /sdp_handshake does on the node the request landed on
+	relayed, err := other.GetSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offer, _ := webrtcsignalingserver.EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: storagetest.OfferSDP})
+	if err = relayed.WriteClientSDPContext(testContext(t), offer, map[string]string{"k": "v"}); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := relayed.ReadServerSDPContext(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if answer.Data["from"] != "owner" {
+		t.Errorf("answer data = %v", answer.Data)
+	}
+
+	if _, err = owner.GetSDPListener("publisher"); err == nil {
+		t.Error("GetSDPListener() handed a relayed listener out again")
+	}
+}
+
+func TestStorage_RelayInform(t *testing.T) {
+	m := runMiniredis(t)
+
+	owner := newStorage(t, m, redisstorage.WithNodeID("owner"))
+	defer owner.Close()
+
+	other := newStorage(t, m, redisstorage.WithNodeID("other"), redisstorage.WithRelayTimeout(5*time.Second))
+	defer other.Close()
+
+	offer, _ := webrtcsignalingserver.EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: storagetest.OfferSDP})
+
+	// The owner closed its listener without removing it, so it refuses the SDP
+	listener, err := owner.AddSDPListener("closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close(nil)
+
+	relayed, err := other.GetSDPListener("closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = relayed.WriteClientSDPContext(testContext(t), offer, nil); !errors.Is(err, webrtcsignalingserver.ErrListenerClosed) {
+		t.Errorf("relayed write to a closed listener = %v, want %v", err, webrtcsignalingserver.ErrListenerClosed)
+	}
+
+	// Answers of sessions keep their session id
+	sessions, err := owner.AddSDPSessionListener("sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sessions.Close(nil)
+
+	opened := make(chan string, 1)
+	go func() {
+		session := <-sessions.Sessions()
+		opened <- session.Id()
+		session.Reply(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}, nil)
+	}()
+
+	relayed, err = other.GetSDPListener("sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = relayed.WriteClientSDPContext(testContext(t), offer, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := relayed.ReadServerSDPContext(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := <-opened; answer.SessionId != id {
+		t.Errorf("relayed answer session id = %q, want %q", answer.SessionId, id)
+	}
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
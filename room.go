@@ -0,0 +1,651 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aliforever/go-httpjson"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// DefaultRoomPeerTimeout drops peers joined over HTTP that stopped polling.
+	DefaultRoomPeerTimeout = time.Minute
+
+	roomInboxSize = 256
+)
+
+type RoomMessageType string
+
+const (
+	RoomMessageJoin            RoomMessageType = "join"
+	RoomMessageLeave           RoomMessageType = "leave"
+	RoomMessageOffer           RoomMessageType = "offer"
+	RoomMessageAnswer          RoomMessageType = "answer"
+	RoomMessageCandidate       RoomMessageType = "candidate"
+	RoomMessageEndOfCandidates RoomMessageType = "end_of_candidates"
+)
+
+// RoomMessage is addressed from one member To another. Join and leave
+// notifications are broadcast by the room itself and carry no To.
+type RoomMessage struct {
+	Type      RoomMessageType          `json:"type"`
+	From      string                   `json:"from"`
+	To        string                   `json:"to,omitempty"`
+	SDP       string                   `json:"sdp,omitempty"` // BASE64
+	Candidate *webrtc.ICECandidateInit `json:"candidate,omitempty"`
+	Data      map[string]string        `json:"data,omitempty"`
+}
+
+func (rm *RoomMessage) Validate() (err error) {
+	if rm.To == "" {
+		err = ErrEmptyTo
+		return
+	}
+
+	switch rm.Type {
+	case RoomMessageOffer, RoomMessageAnswer:
+		var clientSDP *SDPClient
+		clientSDP, err = NewClientSDP(rm.SDP, nil)
+		if err != nil {
+			return
+		}
+
+		err = checkSDPType(clientSDP, webrtc.NewSDPType(string(rm.Type)))
+		if err != nil {
+			return
+		}
+	case RoomMessageCandidate:
+		if rm.Candidate == nil {
+			err = ErrEmptyCandidate
+			return
+		}
+	case RoomMessageEndOfCandidates:
+	default:
+		err = ErrInvalidMessageType
+	}
+
+	return
+}
+
+type roomRegistry struct {
+	rooms       map[string]*Room
+	peerTimeout time.Duration
+
+	// Whether a sweeper expires members joined over HTTP in rooms nobody touches
+	sweeping bool
+
+	// relay rewrites a message on its way to another member; false drops it
+	relay func(roomID string, message *RoomMessage) (deliver bool, err error)
+
+	// Guards every room's members as well
+	m sync.Mutex
+}
+
+func newRoomRegistry(peerTimeout time.Duration) *roomRegistry {
+	return &roomRegistry{
+		rooms:       map[string]*Room{},
+		peerTimeout: peerTimeout,
+	}
+}
+
+type Room struct {
+	id        string
+	createdAt time.Time
+	members   map[string]*RoomMember
+	registry  *roomRegistry
+}
+
+type RoomMember struct {
+	id       string
+	room     *Room
+	data     map[string]string
+	joinedAt time.Time
+	token    string
+
+	inbox *queue[*RoomMessage]
+	left  chan struct{}
+
+	// Members joined over HTTP expire when they stop polling
+	expires  bool
+	lastSeen time.Time
+}
+
+func (rr *roomRegistry) join(roomID, peerID string, data map[string]string, expires bool) (member *RoomMember, err error) {
+	var token string
+	token, err = newToken()
+	if err != nil {
+		return
+	}
+
+	rr.m.Lock()
+	defer rr.m.Unlock()
+
+	now := time.Now()
+
+	if room, exists := rr.rooms[roomID]; exists {
+		// May empty and delete the room
+		rr.expireStale(room, now)
+	}
+
+	room, exists := rr.rooms[roomID]
+	if !exists {
+		room = &Room{id: roomID, createdAt: now, members: map[string]*RoomMember{}, registry: rr}
+		rr.rooms[roomID] = room
+	}
+
+	if _, exists = room.members[peerID]; exists {
+		err = ErrPeerExists
+		return
+	}
+
+	member = &RoomMember{
+		id:       peerID,
+		room:     room,
+		data:     data,
+		joinedAt: now,
+		token:    token,
+		inbox:    newQueue[*RoomMessage](),
+		left:     make(chan struct{}),
+		expires:  expires,
+		lastSeen: now,
+	}
+
+	rr.broadcast(room, &RoomMessage{Type: RoomMessageJoin, From: peerID, Data: data})
+	room.members[peerID] = member
+
+	if expires && !rr.sweeping && rr.peerTimeout > 0 {
+		rr.sweeping = true
+		go rr.runSweeper(rr.peerTimeout)
+	}
+
+	return
+}
+
+// leave must be called with rr.m held.
+func (rr *roomRegistry) leave(member *RoomMember, data map[string]string) (err error) {
+	room := member.room
+	if room.members[member.id] != member {
+		err = ErrPeerNotFound
+		return
+	}
+
+	delete(room.members, member.id)
+	close(member.left)
+
+	rr.broadcast(room, &RoomMessage{Type: RoomMessageLeave, From: member.id, Data: data})
+
+	if len(room.members) == 0 && rr.rooms[room.id] == room {
+		delete(rr.rooms, room.id)
+	}
+
+	return
+}
+
+// broadcast must be called with rr.m held. Notifications skip the inbox limit
+// so no member misses a join or leave.
+func (rr *roomRegistry) broadcast(room *Room, message *RoomMessage) {
+	for _, member := range room.members {
+		member.inbox.push(message)
+	}
+}
+
+// expireStale must be called with rr.m held.
+func (rr *roomRegistry) expireStale(room *Room, now time.Time) {
+	if rr.peerTimeout <= 0 {
+		return
+	}
+
+	for _, member := range room.members {
+		if member.expires && now.Sub(member.lastSeen) > rr.peerTimeout {
+			rr.leave(member, map[string]string{"reason": "timeout"})
+		}
+	}
+}
+
+// runSweeper expires stale members every interval, so rooms everyone stopped
+// polling are deleted too. It stops once no member joined over HTTP is left.
+func (rr *roomRegistry) runSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if !rr.sweep(now) {
+			return
+		}
+	}
+}
+
+// sweep expires stale members of every room and reports whether members
+// joined over HTTP remain.
+func (rr *roomRegistry) sweep(now time.Time) (remaining bool) {
+	rr.m.Lock()
+	defer rr.m.Unlock()
+
+	for _, room := range rr.rooms {
+		rr.expireStale(room, now)
+
+		for _, member := range room.members {
+			remaining = remaining || member.expires
+		}
+	}
+
+	rr.sweeping = remaining
+	return
+}
+
+// closeAll removes every member of every room, their reads fail from then on.
+func (rr *roomRegistry) closeAll(data map[string]string) {
+	rr.m.Lock()
+	defer rr.m.Unlock()
+
+	for _, room := range rr.rooms {
+		for _, member := range room.members {
+			rr.leave(member, data)
+		}
+	}
+}
+
+func (rr *roomRegistry) room(roomID string) (room *Room, err error) {
+	rr.m.Lock()
+	defer rr.m.Unlock()
+
+	var exists bool
+	room, exists = rr.rooms[roomID]
+	if !exists {
+		err = ErrRoomNotFound
+		return
+	}
+
+	rr.expireStale(room, time.Now())
+	return
+}
+
+// member finds a member joined over HTTP by its token and marks it as seen.
+func (rr *roomRegistry) member(roomID, peerID, token string) (member *RoomMember, err error) {
+	rr.m.Lock()
+	defer rr.m.Unlock()
+
+	room, exists := rr.rooms[roomID]
+	if !exists {
+		err = ErrRoomNotFound
+		return
+	}
+
+	now := time.Now()
+	rr.expireStale(room, now)
+
+	member, exists = room.members[peerID]
+	if !exists || subtle.ConstantTimeCompare([]byte(member.token), []byte(token)) != 1 {
+		member = nil
+		err = ErrPeerNotFound
+		return
+	}
+
+	member.lastSeen = now
+	return
+}
+
+func (r *Room) Id() string {
+	return r.id
+}
+
+func (r *Room) CreatedAt() time.Time {
+	return r.createdAt
+}
+
+// Members lists the ids of everyone in the room, sorted.
+func (r *Room) Members() (ids []string) {
+	r.registry.m.Lock()
+	defer r.registry.m.Unlock()
+
+	ids = make([]string, 0, len(r.members))
+	for id := range r.members {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return
+}
+
+func (m *RoomMember) Id() string {
+	return m.id
+}
+
+func (m *RoomMember) Room() *Room {
+	return m.room
+}
+
+func (m *RoomMember) Data() map[string]string {
+	return m.data
+}
+
+func (m *RoomMember) JoinedAt() time.Time {
+	return m.joinedAt
+}
+
+// Send routes message to message.To; From is always set to this member. SDPs
+// go through the SDP middleware and candidates the CandidatePolicy drops are
+// not delivered, without an error.
+func (m *RoomMember) Send(message *RoomMessage) (err error) {
+	err = message.Validate()
+	if err != nil {
+		return
+	}
+
+	registry := m.room.registry
+
+	routed := *message
+	routed.From = m.id
+
+	if registry.relay != nil {
+		var deliver bool
+		deliver, err = registry.relay(m.room.id, &routed)
+		if err != nil || !deliver {
+			return
+		}
+	}
+
+	registry.m.Lock()
+	defer registry.m.Unlock()
+
+	if m.room.members[m.id] != m {
+		err = ErrPeerNotFound
+		return
+	}
+
+	to, exists := m.room.members[message.To]
+	if !exists {
+		err = ErrRecipientNotFound
+		return
+	}
+
+	if to.inbox.len() >= roomInboxSize {
+		err = ErrRecipientInboxFull
+		return
+	}
+
+	to.inbox.push(&routed)
+
+	return
+}
+
+func (m *RoomMember) SendSDP(to string, sdp *webrtc.SessionDescription, data map[string]string) (err error) {
+	var sdpBase64 string
+	sdpBase64, err = EncodeWebrtcSdpToBase64(sdp)
+	if err != nil {
+		return
+	}
+
+	err = m.Send(&RoomMessage{Type: RoomMessageType(sdp.Type.String()), To: to, SDP: sdpBase64, Data: data})
+	return
+}
+
+func (m *RoomMember) SendCandidate(to string, candidate webrtc.ICECandidateInit) (err error) {
+	err = m.Send(&RoomMessage{Type: RoomMessageCandidate, To: to, Candidate: &candidate})
+	return
+}
+
+func (m *RoomMember) SendEndOfCandidates(to string) (err error) {
+	err = m.Send(&RoomMessage{Type: RoomMessageEndOfCandidates, To: to})
+	return
+}
+
+// ReadContext blocks until a message for this member arrives. It fails once
+// the member left the room and its inbox is empty.
+func (m *RoomMember) ReadContext(ctx context.Context) (message *RoomMessage, err error) {
+	for {
+		var ok bool
+		if message, ok = m.inbox.tryPop(); ok {
+			return
+		}
+
+		select {
+		case <-m.inbox.ready:
+		case <-m.left:
+			if message, ok = m.inbox.tryPop(); !ok {
+				err = ErrPeerLeft
+			}
+			return
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
+
+// Pending returns and forgets every message nobody has read yet; it never blocks.
+func (m *RoomMember) Pending() []*RoomMessage {
+	return m.inbox.drain()
+}
+
+func (m *RoomMember) Leave() (err error) {
+	registry := m.room.registry
+
+	registry.m.Lock()
+	defer registry.m.Unlock()
+
+	err = registry.leave(m, nil)
+	return
+}
+
+// rewriteRoomMessage applies the SDP middleware and the CandidatePolicy to a
+// message relayed in the room of roomID, as to any client SDP.
+func (ss *SignalingServer) rewriteRoomMessage(roomID string, message *RoomMessage) (deliver bool, err error) {
+	switch message.Type {
+	case RoomMessageOffer, RoomMessageAnswer:
+		var clientSDP *SDPClient
+		clientSDP, err = NewClientSDP(message.SDP, message.Data)
+		if err != nil {
+			return
+		}
+
+		err = ss.rewriteClientSDP(roomID, nil, clientSDP)
+		if err != nil {
+			return
+		}
+
+		message.SDP = clientSDP.Base64()
+	case RoomMessageCandidate:
+		message.Candidate, deliver = ss.filterTrickled(SDPFromClient, message.Candidate)
+		return
+	}
+
+	deliver = true
+	return
+}
+
+// JoinRoom adds peerID to roomID, creating the room if needed. Everyone
+// already in the room is notified with a join message.
+func (ss *SignalingServer) JoinRoom(roomID, peerID string, data map[string]string) (member *RoomMember, err error) {
+	if roomID == "" || peerID == "" {
+		err = ErrEmptyID
+		return
+	}
+
+	member, err = ss.rooms.join(roomID, peerID, data, false)
+	return
+}
+
+func (ss *SignalingServer) Room(roomID string) (room *Room, err error) {
+	room, err = ss.rooms.room(roomID)
+	return
+}
+
+func newToken() (token string, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	token = hex.EncodeToString(b)
+	return
+}
+
+type roomJoinRequest struct {
+	Room string            `json:"room"`
+	Peer string            `json:"peer"`
+	Data map[string]string `json:"data"`
+}
+
+func (rjr *roomJoinRequest) Validate() (err error) {
+	if rjr.Room == "" || rjr.Peer == "" {
+		err = ErrEmptyID
+		return
+	}
+
+	return
+}
+
+type roomJoinResponse struct {
+	Token   string   `json:"token"`
+	Members []string `json:"members"`
+}
+
+// roomPeerRequest identifies a member joined over HTTP by the token /room_join
+// handed out, so peers cannot act for each other.
+type roomPeerRequest struct {
+	Room    string       `json:"room"`
+	Peer    string       `json:"peer"`
+	Token   string       `json:"token"`
+	Message *RoomMessage `json:"message,omitempty"`
+}
+
+func (rpr *roomPeerRequest) Validate() (err error) {
+	if rpr.Room == "" || rpr.Peer == "" {
+		err = ErrEmptyID
+		return
+	}
+
+	if rpr.Token == "" {
+		err = ErrEmptyToken
+		return
+	}
+
+	return
+}
+
+type roomPollResponse struct {
+	Members  []string       `json:"members"`
+	Messages []*RoomMessage `json:"messages"`
+}
+
+func (ss *SignalingServer) roomJoinHandler(writer http.ResponseWriter, request *http.Request) {
+	var rjr *roomJoinRequest
+
+	if !parseRequest(writer, request, &rjr) {
+		return
+	}
+
+	err := rjr.Validate()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	if !ss.admit(writer, request, ActionRoom, rjr.Room) {
+		return
+	}
+
+	member, err := ss.rooms.join(rjr.Room, rjr.Peer, rjr.Data, true)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	httpjson.Ok(writer, &roomJoinResponse{Token: member.token, Members: member.room.Members()})
+}
+
+func (ss *SignalingServer) roomLeaveHandler(writer http.ResponseWriter, request *http.Request) {
+	_, member, ok := ss.parseRoomPeerRequest(writer, request)
+	if !ok {
+		return
+	}
+
+	err := member.Leave()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	httpjson.Ok(writer, "success")
+}
+
+func (ss *SignalingServer) roomSendHandler(writer http.ResponseWriter, request *http.Request) {
+	rpr, member, ok := ss.parseRoomPeerRequest(writer, request)
+	if !ok {
+		return
+	}
+
+	if rpr.Message == nil {
+		writeError(writer, ErrEmptyMessage)
+		return
+	}
+
+	err := member.Send(rpr.Message)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	httpjson.Ok(writer, "success")
+}
+
+func (ss *SignalingServer) roomPollHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, ErrMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	rpr := &roomPeerRequest{Room: query.Get("room"), Peer: query.Get("peer"), Token: query.Get("token")}
+
+	err := rpr.Validate()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	if !ss.admit(writer, request, ActionRoom, rpr.Room) {
+		return
+	}
+
+	member, err := ss.rooms.member(rpr.Room, rpr.Peer, rpr.Token)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	httpjson.Ok(writer, &roomPollResponse{Members: member.room.Members(), Messages: member.Pending()})
+}
+
+func (ss *SignalingServer) parseRoomPeerRequest(writer http.ResponseWriter, request *http.Request) (rpr *roomPeerRequest, member *RoomMember, ok bool) {
+	if !parseRequest(writer, request, &rpr) {
+		return
+	}
+
+	err := rpr.Validate()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	if !ss.admit(writer, request, ActionRoom, rpr.Room) {
+		return
+	}
+
+	member, err = ss.rooms.member(rpr.Room, rpr.Peer, rpr.Token)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	ok = true
+	return
+}
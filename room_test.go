@@ -0,0 +1,204 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestRoom_Mesh(t *testing.T) {
+	ss := New()
+
+	alice, err := ss.JoinRoom("call", "alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := ss.JoinRoom("call", "bob", map[string]string{"name": "Bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ss.JoinRoom("call", "bob", nil); err == nil {
+		t.Error("JoinRoom() with a taken peer id succeeded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	joined, err := alice.ReadContext(ctx)
+	if err != nil || joined.Type != RoomMessageJoin || joined.From != "bob" || joined.Data["name"] != "Bob" {
+		t.Fatalf("ReadContext() = %+v, %v, want bob's join", joined, err)
+	}
+
+	offer := &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP}
+	if err = alice.SendSDP("bob", offer, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = alice.SendCandidate("bob", webrtc.ICECandidateInit{Candidate: "candidate:1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = alice.SendSDP("carol", offer, nil); err == nil {
+		t.Error("SendSDP() to a peer outside the room succeeded")
+	}
+
+	if err = alice.Send(&RoomMessage{Type: RoomMessageAnswer, To: "bob", SDP: testOfferBase64(t)}); err == nil {
+		t.Error("Send() of an offer as an answer succeeded")
+	}
+
+	got, err := bob.ReadContext(ctx)
+	if err != nil || got.Type != RoomMessageOffer || got.From != "alice" {
+		t.Fatalf("ReadContext() = %+v, %v, want alice's offer", got, err)
+	}
+
+	got, err = bob.ReadContext(ctx)
+	if err != nil || got.Type != RoomMessageCandidate || got.Candidate.Candidate != "candidate:1" {
+		t.Fatalf("ReadContext() = %+v, %v, want alice's candidate", got, err)
+	}
+
+	room, err := ss.Room("call")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"alice", "bob"}; !reflect.DeepEqual(room.Members(), want) {
+		t.Errorf("Members() = %v, want %v", room.Members(), want)
+	}
+
+	if err = bob.Leave(); err != nil {
+		t.Fatal(err)
+	}
+
+	left, err := alice.ReadContext(ctx)
+	if err != nil || left.Type != RoomMessageLeave || left.From != "bob" {
+		t.Fatalf("ReadContext() = %+v, %v, want bob's leave", left, err)
+	}
+
+	if _, err = bob.ReadContext(ctx); err == nil {
+		t.Error("ReadContext() after Leave() succeeded")
+	}
+
+	if err = alice.Leave(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ss.Room("call"); err == nil {
+		t.Error("Room() found an empty room")
+	}
+}
+
+func TestRoom_HTTP(t *testing.T) {
+	ss := New(WithRoomPeerTimeout(50 * time.Millisecond))
+
+	join := func(peer string) string {
+		recorder := httptest.NewRecorder()
+		body := `{"room":"call","peer":"` + peer + `"}`
+		ss.roomJoinHandler(recorder, httptest.NewRequest(http.MethodPost, "/room_join", strings.NewReader(body)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("join status = %d %s", recorder.Code, recorder.Body.String())
+		}
+
+		var response struct {
+			Data *roomJoinResponse `json:"data"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Data.Token
+	}
+
+	poll := func(peer, token string) (int, *roomPollResponse) {
+		recorder := httptest.NewRecorder()
+		url := "/room_poll?room=call&peer=" + peer + "&token=" + token
+		ss.roomPollHandler(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+
+		var response struct {
+			Data *roomPollResponse `json:"data"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response.Data
+	}
+
+	aliceToken := join("alice")
+	bobToken := join("bob")
+
+	recorder := httptest.NewRecorder()
+	body := `{"room":"call","peer":"bob","token":"` + aliceToken + `","message":{"type":"end_of_candidates","to":"alice"}}`
+	ss.roomSendHandler(recorder, httptest.NewRequest(http.MethodPost, "/room_send", strings.NewReader(body)))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("send with another peer's token status = %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	body = `{"room":"call","peer":"bob","token":"` + bobToken + `","message":{"type":"end_of_candidates","to":"alice"}}`
+	ss.roomSendHandler(recorder, httptest.NewRequest(http.MethodPost, "/room_send", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("send status = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	code, polled := poll("alice", aliceToken)
+	if code != http.StatusOK || len(polled.Messages) != 2 {
+		t.Fatalf("poll = %d %+v, want bob's join and end of candidates", code, polled)
+	}
+
+	if polled.Messages[1].Type != RoomMessageEndOfCandidates || polled.Messages[1].From != "bob" {
+		t.Errorf("poll message = %+v", polled.Messages[1])
+	}
+
+	// bob stops polling and is dropped, alice keeps polling
+	var messages []*RoomMessage
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+
+		code, polled = poll("alice", aliceToken)
+		if code != http.StatusOK {
+			t.Fatalf("poll status = %d", code)
+		}
+		messages = append(messages, polled.Messages...)
+	}
+
+	if !reflect.DeepEqual(polled.Members, []string{"alice"}) {
+		t.Errorf("poll members = %v, want bob gone", polled.Members)
+	}
+
+	if len(messages) != 1 || messages[0].Type != RoomMessageLeave || messages[0].From != "bob" {
+		t.Errorf("poll messages = %+v, want bob's leave", messages)
+	}
+
+	if code, _ = poll("bob", bobToken); code != http.StatusNotFound {
+		t.Errorf("poll of an expired peer status = %d", code)
+	}
+}
+
+func TestRoom_SweepAbandoned(t *testing.T) {
+	ss := New(WithRoomPeerTimeout(20 * time.Millisecond))
+
+	if _, err := ss.rooms.join("call", "alice", nil, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody polls or looks the room up, the sweeper still deletes it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ss.rooms.m.Lock()
+		rooms, sweeping := len(ss.rooms.rooms), ss.rooms.sweeping
+		ss.rooms.m.Unlock()
+
+		if rooms == 0 && !sweeping {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d rooms left, sweeping %v, want the abandoned room deleted", rooms, sweeping)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
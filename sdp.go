@@ -11,6 +11,8 @@ type SDPServer struct {
 	sdp       *webrtc.SessionDescription
 	SDPBase64 string            `json:"sdp"`
 	Data      map[string]string `json:"data,omitempty"`
+	// Set when the answer comes from a Session, candidates for it carry this id
+	SessionId string `json:"session_id,omitempty"`
 }
 
 func (s *SDPServer) Base64() (sd string) {
@@ -21,12 +23,19 @@ func DecodeBase64StringToWebrtcSDP(sdpBase64Str string) (sdp *webrtc.SessionDesc
 	var decodedBase64 []byte
 	decodedBase64, err = base64.StdEncoding.DecodeString(sdpBase64Str)
 	if err != nil {
+		err = wrapError(ErrInvalidSDP, err)
 		return
 	}
 
 	var webrtcSDP *webrtc.SessionDescription
 	err = json.Unmarshal(decodedBase64, &webrtcSDP)
 	if err != nil {
+		err = wrapError(ErrInvalidSDP, err)
+		return
+	}
+
+	if webrtcSDP == nil {
+		err = ErrInvalidSDP
 		return
 	}
 
@@ -34,7 +43,14 @@ func DecodeBase64StringToWebrtcSDP(sdpBase64Str string) (sdp *webrtc.SessionDesc
 	return
 }
 
-func newServerSDP(sdp *webrtc.SessionDescription, data map[string]string) (serverSDP *SDPServer, err error) {
+// NewServerSDP encodes an answer, or offer, of the owner of a listener, e.g.
+// for Listener.WriteSDPServerContext.
+func NewServerSDP(sdp *webrtc.SessionDescription, data map[string]string) (serverSDP *SDPServer, err error) {
+	if sdp == nil {
+		err = ErrInvalidSDP
+		return
+	}
+
 	var sdpBase64 string
 	sdpBase64, err = EncodeWebrtcSdpToBase64(sdp)
 	if err != nil {
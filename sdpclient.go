@@ -4,34 +4,76 @@ import (
 	"encoding/base64"
 	"encoding/json"
 
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type SDPClient struct {
-	b64  string
-	sdp  *webrtc.SessionDescription
-	data map[string]string
+	b64       string
+	sdp       *webrtc.SessionDescription
+	parsed    *sdp.SessionDescription
+	data      map[string]string
+	principal *Principal
+	requestID string
+	informed  bool
+
+	spanContext trace.SpanContext
 }
 
 func (sc *SDPClient) SDP() *webrtc.SessionDescription {
 	return sc.sdp
 }
 
+func (sc *SDPClient) Base64() string {
+	return sc.b64
+}
+
 func (sc *SDPClient) Data() map[string]string {
 	return sc.data
 }
 
-func newClientSDP(sdpBase64Str string, data map[string]string) (sdp *SDPClient, err error) {
+// ParsedSDP is the SDP as checked on ingest, see ParseSDP.
+func (sc *SDPClient) ParsedSDP() *sdp.SessionDescription {
+	return sc.parsed
+}
+
+// Principal is who sent the SDP, nil when no Authenticator is set.
+func (sc *SDPClient) Principal() *Principal {
+	return sc.principal
+}
+
+// RequestID is the correlation id of the request that sent the SDP, see
+// RequestIDHeader.
+func (sc *SDPClient) RequestID() string {
+	return sc.requestID
+}
+
+// Informed reports whether the SDP came from /sdp_inform, whose client waits
+// for no answer.
+func (sc *SDPClient) Informed() bool {
+	return sc.informed
+}
+
+// NewClientSDP decodes a base64 encoded session description and rejects it
+// unless ParseSDP accepts it.
+func NewClientSDP(sdpBase64Str string, data map[string]string) (sdp *SDPClient, err error) {
 	var webrtcSDP *webrtc.SessionDescription
 	webrtcSDP, err = DecodeBase64StringToWebrtcSDP(sdpBase64Str)
 	if err != nil {
 		return
 	}
 
+	parsed, err := ParseSDP(webrtcSDP)
+	if err != nil {
+		return
+	}
+
 	sdp = &SDPClient{
-		b64:  sdpBase64Str,
-		data: data,
-		sdp:  webrtcSDP,
+		b64:    sdpBase64Str,
+		data:   data,
+		sdp:    webrtcSDP,
+		parsed: parsed,
 	}
 	return
 }
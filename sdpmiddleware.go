@@ -0,0 +1,147 @@
+package webrtcsignalingserver
+
+import (
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// SDPOrigin tells which side of a handshake an SDP comes from.
+type SDPOrigin string
+
+const (
+	// SDPFromClient is an SDP posted to the server, on its way to a listener
+	SDPFromClient SDPOrigin = "client"
+	// SDPFromServer is a listener's SDP, on its way back to the client
+	SDPFromServer SDPOrigin = "server"
+)
+
+// SDPRewrite is an SDP passing through the server. Middleware changes
+// Description in place; the SDP is delivered as it is afterwards.
+type SDPRewrite struct {
+	// Id of the listener the SDP is exchanged with, of the stored SDP or of
+	// the room it is relayed in
+	Id          string
+	Origin      SDPOrigin
+	Type        webrtc.SDPType
+	Description *sdp.SessionDescription
+	Data        map[string]string
+	// Principal of the client, nil when no Authenticator is set and for room
+	// messages
+	Principal *Principal
+}
+
+// SDPMiddleware rewrites SDPs in flight, see WithSDPMiddleware. Returning an
+// error rejects the SDP; errors that are no Error are answered as
+// ErrSDPRejected.
+type SDPMiddleware interface {
+	RewriteSDP(rewrite *SDPRewrite) (err error)
+}
+
+type SDPMiddlewareFunc func(rewrite *SDPRewrite) (err error)
+
+func (f SDPMiddlewareFunc) RewriteSDP(rewrite *SDPRewrite) (err error) {
+	err = f(rewrite)
+	return
+}
+
+// OnlyFrom applies middleware to the SDPs of origin only.
+func OnlyFrom(origin SDPOrigin, middleware SDPMiddleware) SDPMiddleware {
+	return SDPMiddlewareFunc(func(rewrite *SDPRewrite) (err error) {
+		if rewrite.Origin == origin {
+			err = middleware.RewriteSDP(rewrite)
+		}
+		return
+	})
+}
+
+// rewriteSDP runs every middleware on rewrite and returns the SDP they leave.
+func (ss *SignalingServer) rewriteSDP(rewrite *SDPRewrite) (rewritten string, err error) {
+	for _, middleware := range ss.sdpMiddleware {
+		err = middleware.RewriteSDP(rewrite)
+		if err != nil {
+			err = asError(err, ErrSDPRejected)
+			return
+		}
+	}
+
+	var marshaled []byte
+	marshaled, err = rewrite.Description.Marshal()
+	if err != nil {
+		return
+	}
+
+	rewritten = string(marshaled)
+	return
+}
+
+// rewriteClientSDP runs the middleware on a client SDP for the listener of id.
+func (ss *SignalingServer) rewriteClientSDP(id string, principal *Principal, clientSDP *SDPClient) (err error) {
+	if len(ss.sdpMiddleware) == 0 {
+		return
+	}
+
+	rewrite := &SDPRewrite{
+		Id:          id,
+		Origin:      SDPFromClient,
+		Type:        clientSDP.sdp.Type,
+		Description: clientSDP.parsed,
+		Data:        clientSDP.data,
+		Principal:   principal,
+	}
+
+	var rewritten string
+	rewritten, err = ss.rewriteSDP(rewrite)
+	if err != nil {
+		return
+	}
+
+	description := &webrtc.SessionDescription{Type: clientSDP.sdp.Type, SDP: rewritten}
+
+	var b64 string
+	b64, err = EncodeWebrtcSdpToBase64(description)
+	if err != nil {
+		return
+	}
+
+	clientSDP.sdp, clientSDP.b64, clientSDP.parsed = description, b64, rewrite.Description
+	return
+}
+
+// rewriteServerSDP runs the middleware on the answer of the listener of id.
+func (ss *SignalingServer) rewriteServerSDP(id string, principal *Principal, serverSDP *SDPServer) (err error) {
+	if len(ss.sdpMiddleware) == 0 {
+		return
+	}
+
+	var parsed *sdp.SessionDescription
+	parsed, err = serverSDP.sdp.Unmarshal()
+	if err != nil {
+		return
+	}
+
+	rewrite := &SDPRewrite{
+		Id:          id,
+		Origin:      SDPFromServer,
+		Type:        serverSDP.sdp.Type,
+		Description: parsed,
+		Data:        serverSDP.Data,
+		Principal:   principal,
+	}
+
+	var rewritten string
+	rewritten, err = ss.rewriteSDP(rewrite)
+	if err != nil {
+		return
+	}
+
+	description := &webrtc.SessionDescription{Type: serverSDP.sdp.Type, SDP: rewritten}
+
+	var b64 string
+	b64, err = EncodeWebrtcSdpToBase64(description)
+	if err != nil {
+		return
+	}
+
+	serverSDP.sdp, serverSDP.SDPBase64 = description, b64
+	return
+}
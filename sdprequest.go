@@ -1,19 +1,45 @@
 package webrtcsignalingserver
 
 import (
-	"errors"
+	"github.com/pion/webrtc/v3"
 )
 
 type sDPRequest struct {
 	Id   string            `json:"id"`
 	SDP  string            `json:"sdp"` // BASE64
 	Data map[string]string `json:"data"`
+	TTL  int               `json:"ttl,omitempty"` // Seconds, only used by /sdp_store
 }
 
 func (sr *sDPRequest) Validate() (err error) {
 	if sr.Id == "" {
-		err = errors.New("empty_id")
+		err = ErrEmptyID
 		return
 	}
+
+	if sr.TTL < 0 {
+		err = ErrInvalidTTL
+		return
+	}
+	return
+}
+
+func (sr *sDPRequest) DecodeSDP() (sdp *webrtc.SessionDescription, err error) {
+	sdp, err = DecodeBase64StringToWebrtcSDP(sr.SDP)
+	return
+}
+
+// ClientSDP decodes and checks the SDP, which has to be one of types.
+func (sr *sDPRequest) ClientSDP(types ...webrtc.SDPType) (clientSDP *SDPClient, err error) {
+	clientSDP, err = NewClientSDP(sr.SDP, sr.Data)
+	if err != nil {
+		return
+	}
+
+	err = checkSDPType(clientSDP, types...)
+	if err != nil {
+		clientSDP = nil
+	}
+
 	return
 }
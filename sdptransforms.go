@@ -0,0 +1,200 @@
+package webrtcsignalingserver
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+var directionAttributes = []string{"sendrecv", "sendonly", "recvonly", "inactive"}
+
+// RemoveCodecs strips the codecs named, e.g. "H264", from audio and video
+// sections along with their retransmission (rtx) payload types, so the other
+// side negotiates one of the rest. A section left without codecs is rejected
+// with port 0, as RFC 3264 does, and leaves its BUNDLE group.
+func RemoveCodecs(names ...string) SDPMiddleware {
+	return SDPMiddlewareFunc(func(rewrite *SDPRewrite) (err error) {
+		var rejected []string
+		for _, media := range rewrite.Description.MediaDescriptions {
+			if !isRTPMedia(media) {
+				continue
+			}
+
+			removed := map[string]bool{}
+			for _, attribute := range media.Attributes {
+				if attribute.Key != "rtpmap" {
+					continue
+				}
+
+				payloadType, codec, _ := strings.Cut(attribute.Value, " ")
+				codec, _, _ = strings.Cut(codec, "/")
+				for _, name := range names {
+					if strings.EqualFold(codec, name) {
+						removed[payloadType] = true
+					}
+				}
+			}
+
+			// rtx payload types point at their codec with apt=<payload type>
+			for _, attribute := range media.Attributes {
+				payloadType, parameters, _ := strings.Cut(attribute.Value, " ")
+				if attribute.Key == "fmtp" && strings.HasPrefix(parameters, "apt=") && removed[strings.TrimPrefix(parameters, "apt=")] {
+					removed[payloadType] = true
+				}
+			}
+
+			if len(removed) == 0 {
+				continue
+			}
+
+			formats := media.MediaName.Formats[:0]
+			for _, format := range media.MediaName.Formats {
+				if !removed[format] {
+					formats = append(formats, format)
+				}
+			}
+
+			if len(formats) == 0 && len(media.MediaName.Formats) > 0 {
+				// An m= line needs a format even when rejected
+				formats = append(formats, media.MediaName.Formats[0])
+				media.MediaName.Port = sdp.RangedPort{Value: 0}
+
+				if mid, ok := media.Attribute("mid"); ok {
+					rejected = append(rejected, mid)
+				}
+			}
+			media.MediaName.Formats = formats
+
+			attributes := media.Attributes[:0]
+			for _, attribute := range media.Attributes {
+				payloadType, _, _ := strings.Cut(attribute.Value, " ")
+				isCodecAttribute := attribute.Key == "rtpmap" || attribute.Key == "fmtp" || attribute.Key == "rtcp-fb"
+				if !isCodecAttribute || !removed[payloadType] {
+					attributes = append(attributes, attribute)
+				}
+			}
+			media.Attributes = attributes
+		}
+
+		unbundle(rewrite.Description, rejected)
+		return
+	})
+}
+
+// unbundle takes mids out of the BUNDLE groups of description, dropping groups
+// left empty.
+func unbundle(description *sdp.SessionDescription, mids []string) {
+	if len(mids) == 0 {
+		return
+	}
+
+	attributes := description.Attributes[:0]
+	for _, attribute := range description.Attributes {
+		fields := strings.Fields(attribute.Value)
+		if attribute.Key != "group" || len(fields) == 0 || fields[0] != "BUNDLE" {
+			attributes = append(attributes, attribute)
+			continue
+		}
+
+		fields = slices.DeleteFunc(fields, func(mid string) bool {
+			return slices.Contains(mids, mid)
+		})
+		if len(fields) > 1 {
+			attributes = append(attributes, sdp.NewAttribute("group", strings.Join(fields, " ")))
+		}
+	}
+	description.Attributes = attributes
+}
+
+// LimitBandwidth caps the sections of the media kinds given ("audio",
+// "video", ...; audio and video when none are) at kbps with b=AS.
+func LimitBandwidth(kbps uint64, kinds ...string) SDPMiddleware {
+	return SDPMiddlewareFunc(func(rewrite *SDPRewrite) (err error) {
+		for _, media := range rewrite.Description.MediaDescriptions {
+			if !isMediaKind(media, kinds) {
+				continue
+			}
+
+			bandwidths := media.Bandwidth[:0]
+			for _, bandwidth := range media.Bandwidth {
+				if bandwidth.Type != "AS" {
+					bandwidths = append(bandwidths, bandwidth)
+				}
+			}
+			media.Bandwidth = append(bandwidths, sdp.Bandwidth{Type: "AS", Bandwidth: kbps})
+		}
+		return
+	})
+}
+
+// ForceDirection sets the direction of every audio and video section, e.g.
+// webrtc.RTPTransceiverDirectionRecvonly for viewers.
+func ForceDirection(direction webrtc.RTPTransceiverDirection) SDPMiddleware {
+	return SDPMiddlewareFunc(func(rewrite *SDPRewrite) (err error) {
+		for _, media := range rewrite.Description.MediaDescriptions {
+			if !isRTPMedia(media) {
+				continue
+			}
+
+			attributes := media.Attributes[:0]
+			for _, attribute := range media.Attributes {
+				if !slices.Contains(directionAttributes, attribute.Key) {
+					attributes = append(attributes, attribute)
+				}
+			}
+			media.Attributes = append(attributes, sdp.NewPropertyAttribute(direction.String()))
+		}
+		return
+	})
+}
+
+// FilterCandidates drops the candidates of every section that keep returns
+// false for. keep gets them as trickled, "candidate:..." included.
+func FilterCandidates(keep func(candidate string) bool) SDPMiddleware {
+	return SDPMiddlewareFunc(func(rewrite *SDPRewrite) (err error) {
+		for _, media := range rewrite.Description.MediaDescriptions {
+			attributes := media.Attributes[:0]
+			for _, attribute := range media.Attributes {
+				if attribute.Key != "candidate" || keep("candidate:"+attribute.Value) {
+					attributes = append(attributes, attribute)
+				}
+			}
+			media.Attributes = attributes
+		}
+		return
+	})
+}
+
+// RemoveCandidateTypes drops candidates of the types given, e.g. "host" to
+// keep local addresses private.
+func RemoveCandidateTypes(types ...string) SDPMiddleware {
+	return FilterCandidates(func(candidate string) bool {
+		return !slices.Contains(types, CandidateType(candidate))
+	})
+}
+
+// CandidateType is the typ of an ICE candidate ("host", "srflx", "prflx" or
+// "relay"), empty when it has none.
+func CandidateType(candidate string) string {
+	fields := strings.Fields(candidate)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "typ" {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
+
+func isRTPMedia(media *sdp.MediaDescription) bool {
+	return media.MediaName.Media == "audio" || media.MediaName.Media == "video"
+}
+
+func isMediaKind(media *sdp.MediaDescription, kinds []string) bool {
+	if len(kinds) == 0 {
+		return isRTPMedia(media)
+	}
+
+	return slices.Contains(kinds, media.MediaName.Media)
+}
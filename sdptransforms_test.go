@@ -0,0 +1,176 @@
+package webrtcsignalingserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+const testVideoOfferSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=fingerprint:sha-256 E6:32:0F:C2:21:A8:C1:C7:8C:AA:24:A8:F7:49:D5:3A:22:88:68:58:82:37:EA:C9:B0:33:1E:62:62:5F:0B:FA\r\n" +
+	"m=video 9 UDP/TLS/RTP/SAVPF 96 97 102 121\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=ice-ufrag:sMbxeGwbcSAFhgEf\r\n" +
+	"a=ice-pwd:piRMgOyfeyBThjzuaAOxrdUedsOYSmlt\r\n" +
+	"a=mid:0\r\n" +
+	"a=sendrecv\r\n" +
+	"a=rtpmap:96 VP8/90000\r\n" +
+	"a=rtcp-fb:96 nack\r\n" +
+	"a=rtpmap:97 rtx/90000\r\n" +
+	"a=fmtp:97 apt=96\r\n" +
+	"a=rtpmap:102 H264/90000\r\n" +
+	"a=fmtp:102 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f\r\n" +
+	"a=rtcp-fb:102 nack\r\n" +
+	"a=rtpmap:121 rtx/90000\r\n" +
+	"a=fmtp:121 apt=102\r\n" +
+	"a=candidate:1 1 udp 2130706431 192.168.1.107 53379 typ host\r\n" +
+	"a=candidate:2 1 udp 1694498815 5.121.80.63 64985 typ srflx raddr 0.0.0.0 rport 64731\r\n"
+
+func TestSDPTransforms(t *testing.T) {
+	parsed, err := ParseSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testVideoOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrite := &SDPRewrite{Origin: SDPFromClient, Type: webrtc.SDPTypeOffer, Description: parsed}
+	for _, middleware := range []SDPMiddleware{
+		RemoveCodecs("h264"),
+		LimitBandwidth(500),
+		ForceDirection(webrtc.RTPTransceiverDirectionRecvonly),
+		RemoveCandidateTypes("host"),
+		OnlyFrom(SDPFromServer, LimitBandwidth(1)),
+	} {
+		if err = middleware.RewriteSDP(rewrite); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	marshaled, err := rewrite.Description.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(marshaled)
+
+	for _, want := range []string{"m=video 9 UDP/TLS/RTP/SAVPF 96 97\r\n", "b=AS:500\r\n", "a=recvonly\r\n", "a=fmtp:97 apt=96\r\n", "typ srflx"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("rewritten SDP lacks %q:\n%s", want, got)
+		}
+	}
+
+	for _, unwanted := range []string{"H264", ":102 ", ":121 ", "a=sendrecv", "typ host", "b=AS:1\r\n"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("rewritten SDP still has %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestSignalingServer_SDPMiddleware(t *testing.T) {
+	rejectBanned := SDPMiddlewareFunc(func(rewrite *SDPRewrite) error {
+		if rewrite.Data["role"] == "banned" {
+			return errors.New("banned")
+		}
+		return nil
+	})
+
+	ss := New(WithSDPMiddleware(
+		rejectBanned,
+		OnlyFrom(SDPFromClient, ForceDirection(webrtc.RTPTransceiverDirectionRecvonly)),
+		OnlyFrom(SDPFromServer, LimitBandwidth(300)),
+	))
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testVideoOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	body := `{"id":"publisher","sdp":"` + offer + `","data":{"role":"banned"}}`
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), string(CodeSDPRejected)) {
+		t.Fatalf("rejected handshake = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	go func() {
+		clientSDP, err := listener.ReadSDPClientContext(t.Context())
+		if err != nil {
+			return
+		}
+
+		if !strings.Contains(clientSDP.SDP().SDP, "a=recvonly") || !hasDirection(clientSDP.ParsedSDP(), "recvonly") {
+			t.Errorf("delivered SDP was not rewritten:\n%s", clientSDP.SDP().SDP)
+		}
+
+		answer := strings.Replace(testVideoOfferSDP, "a=sendrecv", "a=sendonly", 1)
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer}, nil)
+	}()
+
+	recorder = httptest.NewRecorder()
+	body = `{"id":"publisher","sdp":"` + offer + `"}`
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("handshake = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	var response struct {
+		Data *SDPServer `json:"data"`
+	}
+	if err = json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := DecodeBase64StringToWebrtcSDP(response.Data.SDPBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(answer.SDP, "b=AS:300") || !strings.Contains(answer.SDP, "a=sendonly") {
+		t.Errorf("answer was not rewritten:\n%s", answer.SDP)
+	}
+}
+
+func hasDirection(parsed *sdp.SessionDescription, direction string) bool {
+	_, ok := parsed.MediaDescriptions[0].Attribute(direction)
+	return ok
+}
+
+func TestRemoveCodecs_EverySection(t *testing.T) {
+	bundled := strings.Replace(testVideoOfferSDP, "t=0 0\r\n", "t=0 0\r\na=group:BUNDLE 0\r\n", 1)
+	parsed, err := ParseSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: bundled})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrite := &SDPRewrite{Origin: SDPFromClient, Type: webrtc.SDPTypeOffer, Description: parsed}
+	if err = RemoveCodecs("vp8", "h264").RewriteSDP(rewrite); err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := rewrite.Description.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(marshaled)
+
+	if !strings.Contains(got, "m=video 0 UDP/TLS/RTP/SAVPF 96\r\n") {
+		t.Errorf("rewritten SDP does not reject the section:\n%s", got)
+	}
+	for _, unwanted := range []string{"a=rtpmap", "a=group:BUNDLE"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("rewritten SDP still has %q:\n%s", unwanted, got)
+		}
+	}
+}
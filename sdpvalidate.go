@@ -0,0 +1,65 @@
+package webrtcsignalingserver
+
+import (
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// ParseSDP parses the SDP of description and checks it can set up a
+// connection: it needs a media section, and ICE credentials and a DTLS
+// fingerprint either at session level or in every media section.
+func ParseSDP(description *webrtc.SessionDescription) (parsed *sdp.SessionDescription, err error) {
+	parsed, err = description.Unmarshal()
+	if err != nil {
+		parsed = nil
+		err = wrapError(ErrInvalidSDP, err)
+		return
+	}
+
+	if len(parsed.MediaDescriptions) == 0 {
+		parsed, err = nil, ErrSDPNoMedia
+		return
+	}
+
+	if !hasAttributes(parsed, "ice-ufrag", "ice-pwd") {
+		parsed, err = nil, ErrSDPMissingICECredentials
+		return
+	}
+
+	if !hasAttributes(parsed, "fingerprint") {
+		parsed, err = nil, ErrSDPMissingFingerprint
+		return
+	}
+
+	return
+}
+
+// hasAttributes tells if every media section has each of keys, itself or
+// through the session level.
+func hasAttributes(parsed *sdp.SessionDescription, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := parsed.Attribute(key); ok {
+			continue
+		}
+
+		for _, media := range parsed.MediaDescriptions {
+			if _, ok := media.Attribute(key); !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// checkSDPType returns ErrSDPTypeMismatch unless clientSDP is one of types.
+func checkSDPType(clientSDP *SDPClient, types ...webrtc.SDPType) (err error) {
+	for _, t := range types {
+		if clientSDP.sdp.Type == t {
+			return
+		}
+	}
+
+	err = ErrSDPTypeMismatch
+	return
+}
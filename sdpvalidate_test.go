@@ -0,0 +1,72 @@
+package webrtcsignalingserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestParseSDP(t *testing.T) {
+	fingerprint := "a=fingerprint:sha-256 E6:32:0F:C2:21:A8:C1:C7:8C:AA:24:A8:F7:49:D5:3A:22:88:68:58:82:37:EA:C9:B0:33:1E:62:62:5F:0B:FA\r\n"
+
+	tests := []struct {
+		name    string
+		sdp     string
+		wantErr error
+	}{
+		{name: "valid", sdp: testOfferSDP},
+		{name: "media_level_fingerprint", sdp: strings.Replace(strings.Replace(testOfferSDP, fingerprint, "", 1), "a=mid:0\r\n", "a=mid:0\r\n"+fingerprint, 1)},
+		{name: "malformed", sdp: "v=x\r\n", wantErr: ErrInvalidSDP},
+		{name: "garbage", sdp: "hello", wantErr: ErrSDPNoMedia},
+		{name: "no_media", sdp: testOfferSDP[:strings.Index(testOfferSDP, "m=")], wantErr: ErrSDPNoMedia},
+		{name: "no_ice_ufrag", sdp: strings.Replace(testOfferSDP, "a=ice-ufrag:sMbxeGwbcSAFhgEf\r\n", "", 1), wantErr: ErrSDPMissingICECredentials},
+		{name: "no_fingerprint", sdp: strings.Replace(testOfferSDP, fingerprint, "", 1), wantErr: ErrSDPMissingFingerprint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: tt.sdp})
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (parsed != nil) {
+				t.Errorf("ParseSDP() = %v, %v, want error %v", parsed, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignalingServer_HandshakeSDPType(t *testing.T) {
+	ss := New()
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	body := `{"id":"publisher","sdp":"` + answer + `"}`
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), string(CodeSDPTypeMismatch)) {
+		t.Fatalf("handshake with an answer = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// The rejected request left the listener to the next one
+	recorder = httptest.NewRecorder()
+	body = `{"id":"publisher","sdp":"` + answer + `"}`
+	go ss.sdpInformListenerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_inform", strings.NewReader(body)))
+
+	clientSDP, err := listener.ReadSDPClientContext(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed := clientSDP.ParsedSDP(); parsed == nil || len(parsed.MediaDescriptions) != 1 {
+		t.Errorf("ParsedSDP() = %v, want the parsed answer", parsed)
+	}
+}
@@ -1,17 +1,104 @@
 package webrtcsignalingserver
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/aliforever/go-httpjson"
+	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultHandshakeTimeout = 30 * time.Second
+	DefaultStoredSDPTTL     = 10 * time.Minute
+	DefaultMaxStoredSDPTTL  = 24 * time.Hour
 )
 
 type SignalingServer struct {
-	storage *sdpStorage
+	storage Storage
+
+	handshakeTimeout time.Duration
+	storedSDPTTL     time.Duration
+	maxStoredSDPTTL  time.Duration
+
+	rooms *roomRegistry
+
+	authenticator      Authenticator
+	adminAuthenticator Authenticator
+
+	ipLimiter            *rateLimiter
+	idLimiter            *rateLimiter
+	maxPendingHandshakes int
+	pendingHandshakes    int
+	pendingM             sync.Mutex
+	maxStoredSDPs        int
+	storedSDPs           int
+	storedSDPsCountedAt  time.Time
+	reservedSDPs         int
+	storedM              sync.Mutex
+
+	sdpMiddleware []SDPMiddleware
+
+	candidatePolicy    *CandidatePolicy
+	filteredCandidates candidateFilterCounts
+
+	observers []Observer
+
+	metrics *metrics
+	logger  *slog.Logger
+	tracer  trace.Tracer
+
+	tlsConfig *tls.Config
+	clientCAs *x509.CertPool
+
+	lifecycle lifecycle
+	startedAt time.Time
 }
 
-func New() (ss *SignalingServer) {
-	ss = &SignalingServer{storage: newSDPStorage()}
+func New(options ...Option) (ss *SignalingServer) {
+	ss = &SignalingServer{
+		handshakeTimeout: DefaultHandshakeTimeout,
+		storedSDPTTL:     DefaultStoredSDPTTL,
+		maxStoredSDPTTL:  DefaultMaxStoredSDPTTL,
+		rooms:            newRoomRegistry(DefaultRoomPeerTimeout),
+		startedAt:        time.Now(),
+	}
+
+	for _, option := range options {
+		option(ss)
+	}
+
+	if ss.storage == nil {
+		ss.storage = NewMemoryStorage(DefaultSweepInterval)
+	}
+
+	if ss.logger == nil {
+		ss.logger = slog.New(slog.DiscardHandler)
+	}
+
+	if ss.tracer == nil {
+		ss.tracer = newTracer(nil)
+	}
+
+	if len(ss.observers) > 0 {
+		ss.observeExpiry()
+	}
+
+	if ss.candidatePolicy != nil {
+		// Last, so no middleware adds candidates behind the policy's back
+		ss.sdpMiddleware = append(ss.sdpMiddleware, ss.candidatePolicyMiddleware())
+	}
+
+	ss.rooms.relay = ss.rewriteRoomMessage
+
 	return
 }
 
@@ -21,99 +108,498 @@ func (ss *SignalingServer) Listen(address string, handler *http.ServeMux) (serve
 		m = http.NewServeMux()
 	}
 
-	m.HandleFunc("/sdp_handshake", ss.sdpHandShakerHandler)
-	m.HandleFunc("/sdp_inform", ss.sdpInformListenerHandler)
-	m.HandleFunc("/sdp_store", ss.sdpInformListenerHandler)
+	ss.register(m)
 
 	server = &http.Server{Addr: address, Handler: m}
+
+	ss.lifecycle.m.Lock()
+	if ss.lifecycle.server == nil {
+		// Lets Shutdown stop it as well
+		ss.lifecycle.server = server
+	}
+	ss.lifecycle.m.Unlock()
+
 	err = server.ListenAndServe()
 
 	return
 }
 
+func (ss *SignalingServer) register(m *http.ServeMux) {
+	m.HandleFunc("/sdp_handshake", ss.wrap("sdp_handshake", ss.sdpHandShakerHandler))
+	m.HandleFunc("/sdp_inform", ss.wrap("sdp_inform", ss.sdpInformListenerHandler))
+	m.HandleFunc("/sdp_store", ss.wrap("sdp_store", ss.sdpStoreHandler))
+	m.HandleFunc("/sdp_fetch", ss.wrap("sdp_fetch", ss.sdpFetchHandler))
+	m.HandleFunc("/sdp_candidate", ss.wrap("sdp_candidate", ss.candidateHandler))
+	m.HandleFunc("/sdp_candidates", ss.wrap("sdp_candidates", ss.candidatesPollHandler))
+	m.HandleFunc("/ws", ss.wrap("ws", ss.wsHandler))
+	m.HandleFunc("/room_join", ss.wrap("room_join", ss.roomJoinHandler))
+	m.HandleFunc("/room_leave", ss.wrap("room_leave", ss.roomLeaveHandler))
+	m.HandleFunc("/room_send", ss.wrap("room_send", ss.roomSendHandler))
+	m.HandleFunc("/room_poll", ss.wrap("room_poll", ss.roomPollHandler))
+
+	if ss.adminAuthenticator != nil {
+		ss.registerAdmin(m)
+	}
+
+	if ss.metrics != nil {
+		// Scrapers carry no client credentials, so /metrics is not authenticated
+		m.Handle("/metrics", ss.metrics.handler)
+	}
+}
+
 func (ss *SignalingServer) AddSDPListener(id string) (l *Listener, err error) {
 	l, err = ss.storage.AddSDPListener(id)
+	if err == nil {
+		ss.observe(newEvent(nil, EventListenerRegistered, id, nil))
+	}
+	return
+}
+
+// AddSDPSessionListener registers a listener that serves every handshake made
+// for id, each as its own Session on l.Sessions().
+func (ss *SignalingServer) AddSDPSessionListener(id string) (l *Listener, err error) {
+	l, err = ss.storage.AddSDPSessionListener(id)
+	if err == nil {
+		ss.observe(newEvent(nil, EventListenerRegistered, id, nil))
+	}
+	return
+}
+
+// RemoveSDPListener forgets a listener, including one kept after its handshake
+// so candidates could still be trickled to it.
+func (ss *SignalingServer) RemoveSDPListener(id string) (err error) {
+	err = ss.storage.RemoveSDPListener(id)
+	return
+}
+
+// wrap puts the checks every endpoint shares in front of the handler of endpoint.
+func (ss *SignalingServer) wrap(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return ss.correlate(endpoint, ss.trace(endpoint, ss.instrument(endpoint, ss.rejectWhenClosing(ss.limitIP(ss.authenticate(handler))))))
+}
+
+// admit writes the response and returns false unless the principal of request
+// may do action on id and id is within its rate limit.
+func (ss *SignalingServer) admit(writer http.ResponseWriter, request *http.Request, action Action, id string) bool {
+	return ss.authorize(writer, request, action, id) && ss.limitID(writer, id)
+}
+
+func (ss *SignalingServer) handshakeContext(request *http.Request) (ctx context.Context, cancel context.CancelFunc) {
+	if ss.handshakeTimeout <= 0 {
+		ctx, cancel = context.WithCancel(request.Context())
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(request.Context(), ss.handshakeTimeout)
 	return
 }
 
 func (ss *SignalingServer) sdpHandShakerHandler(writer http.ResponseWriter, request *http.Request) {
+	logger := ss.requestLogger(request.Context())
+
 	var sar *sDPRequest
 
-	err := httpjson.ParseRequest(writer, request, &sar)
+	_, span := ss.tracer.Start(request.Context(), SpanParse)
+	if !parseRequest(writer, request, &sar) {
+		endStage(span, ErrInvalidJSON)
+		return
+	}
+	span.End()
+
+	_, span = ss.tracer.Start(request.Context(), SpanValidate)
+	err := sar.Validate()
 	if err != nil {
+		endStage(span, err)
+		writeError(writer, err)
 		return
 	}
 
-	err = sar.Validate()
+	// The listener answers, so the client has to offer
+	clientSDP, err := sar.ClientSDP(webrtc.SDPTypeOffer)
+	endStage(span, err)
 	if err != nil {
-		httpjson.BadRequest(writer, err.Error())
+		writeError(writer, err)
+		return
+	}
+
+	logger.Debug("request parsed", "id", sar.Id, "type", clientSDP.sdp.Type.String())
+	trace.SpanFromContext(request.Context()).SetAttributes(attribute.String("signaling.id", sar.Id))
+
+	if !ss.admit(writer, request, ActionHandshake, sar.Id) {
 		return
 	}
 
+	principal := PrincipalFromContext(request.Context())
+
+	err = ss.rewriteClientSDP(sar.Id, principal, clientSDP)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	release, ok := ss.acquireHandshake(writer)
+	if !ok {
+		return
+	}
+	defer release()
+
+	_, span = ss.tracer.Start(request.Context(), SpanLookup)
 	listener, err := ss.storage.GetSDPListener(sar.Id)
+	endStage(span, err)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	logger.Debug("listener consumed", "id", sar.Id)
+
+	// Observed as delivered, after the candidate policy, once a listener took it
+	arrived := newEvent(request, EventClientSDPArrived, sar.Id, clientSDP.Data())
+	arrived.SDP = clientSDP.Base64()
+	ss.observe(arrived)
+
+	ctx, cancel := ss.handshakeContext(request)
+	defer cancel()
+
+	delivered := time.Now()
+
+	// The SDP carries the delivery span, for the listener to trace under
+	deliverCtx, span := ss.tracer.Start(ctx, SpanDeliver)
+
+	// Session listeners answer on the listener of a new session
+	answers, err := listener.deliverClientSDP(deliverCtx, clientSDP)
+	endStage(span, err)
 	if err != nil {
-		httpjson.BadRequest(writer, err.Error())
+		ss.abandonHandshake(writer, arrived, answers, err)
 		return
 	}
 
-	err = listener.WriteClientSDP(sar.SDP, sar.Data)
+	logger.Info("client SDP delivered", "id", sar.Id)
+
+	_, span = ss.tracer.Start(ctx, SpanWaitForAnswer)
+	serverSDP, err := answers.ReadServerSDPContext(ctx)
+	endStage(span, err)
 	if err != nil {
-		httpjson.BadRequest(writer, err.Error())
+		ss.abandonHandshake(writer, arrived, answers, err)
 		return
 	}
 
-	serverSDP := listener.ReadServerSDP()
+	ss.metrics.answered("sdp_handshake", delivered)
+	logger.Info("server SDP returned", "id", sar.Id, "type", serverSDP.sdp.Type.String(), "wait", time.Since(delivered))
+
+	_, span = ss.tracer.Start(request.Context(), SpanRespond)
+	defer span.End()
+
+	err = ss.rewriteServerSDP(sar.Id, principal, serverSDP)
+	if err != nil {
+		failSpan(span, err)
+		writeError(writer, err)
+		return
+	}
+
+	answered := arrived.then(EventAnswerSent)
+	answered.Data = serverSDP.Data
+	ss.observe(answered)
 
 	httpjson.Ok(writer, serverSDP)
 }
 
 func (ss *SignalingServer) sdpInformListenerHandler(writer http.ResponseWriter, request *http.Request) {
+	logger := ss.requestLogger(request.Context())
+
 	var sar *sDPRequest
 
-	err := httpjson.ParseRequest(writer, request, &sar)
+	_, span := ss.tracer.Start(request.Context(), SpanParse)
+	if !parseRequest(writer, request, &sar) {
+		endStage(span, ErrInvalidJSON)
+		return
+	}
+	span.End()
+
+	_, span = ss.tracer.Start(request.Context(), SpanValidate)
+	err := sar.Validate()
+	if err != nil {
+		endStage(span, err)
+		writeError(writer, err)
+		return
+	}
+
+	clientSDP, err := sar.ClientSDP(webrtc.SDPTypeOffer, webrtc.SDPTypeAnswer)
+	endStage(span, err)
 	if err != nil {
+		writeError(writer, err)
 		return
 	}
 
-	err = sar.Validate()
+	logger.Debug("request parsed", "id", sar.Id, "type", clientSDP.sdp.Type.String())
+	trace.SpanFromContext(request.Context()).SetAttributes(attribute.String("signaling.id", sar.Id))
+
+	if !ss.admit(writer, request, ActionInform, sar.Id) {
+		return
+	}
+
+	err = ss.rewriteClientSDP(sar.Id, PrincipalFromContext(request.Context()), clientSDP)
 	if err != nil {
-		httpjson.BadRequest(writer, err.Error())
+		writeError(writer, err)
+		return
+	}
+
+	release, ok := ss.acquireHandshake(writer)
+	if !ok {
 		return
 	}
+	defer release()
 
+	_, span = ss.tracer.Start(request.Context(), SpanLookup)
 	var l *Listener
 	l, err = ss.storage.GetSDPListener(sar.Id)
+	endStage(span, err)
 	if err != nil {
-		httpjson.BadRequest(writer, err.Error())
+		writeError(writer, err)
 		return
 	}
 
-	err = l.WriteClientSDP(sar.SDP, sar.Data)
+	logger.Debug("listener consumed", "id", sar.Id)
+
+	arrived := newEvent(request, EventClientSDPArrived, sar.Id, clientSDP.Data())
+	arrived.SDP = clientSDP.Base64()
+	ss.observe(arrived)
+
+	ctx, cancel := ss.handshakeContext(request)
+	defer cancel()
+
+	clientSDP.informed = true
+	deliverCtx, span := ss.tracer.Start(ctx, SpanDeliver)
+
+	var answers *Listener
+	answers, err = l.deliverClientSDP(deliverCtx, clientSDP)
+	endStage(span, err)
 	if err != nil {
-		httpjson.BadRequest(writer, err.Error())
+		ss.abandonHandshake(writer, arrived, answers, err)
 		return
 	}
 
+	logger.Info("client SDP delivered", "id", sar.Id)
+
 	httpjson.Ok(writer, "success")
 }
 
+// abandonHandshake closes the listener when its handler gives up waiting, so
+// the owner blocked on the other end is released with the same error. l is
+// nil when nothing was delivered; timeouts are timed from the event started.
+func (ss *SignalingServer) abandonHandshake(writer http.ResponseWriter, started *Event, l *Listener, err error) {
+	if l != nil && (err == context.DeadlineExceeded || err == context.Canceled) {
+		l.Close(err)
+	}
+
+	switch err {
+	case context.DeadlineExceeded:
+		ss.observe(started.then(EventHandshakeTimeout))
+		writeError(writer, ErrHandshakeTimeout)
+	case context.Canceled:
+		// The client went away, there is nobody left to respond to
+	default:
+		writeError(writer, err)
+	}
+}
+
 func (ss *SignalingServer) sdpStoreHandler(writer http.ResponseWriter, request *http.Request) {
 	var sar *sDPRequest
 
-	err := httpjson.ParseRequest(writer, request, &sar)
+	if !parseRequest(writer, request, &sar) {
+		return
+	}
+
+	err := sar.Validate()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	clientSDP, err := sar.ClientSDP(webrtc.SDPTypeOffer, webrtc.SDPTypeAnswer)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	ss.requestLogger(request.Context()).Debug("request parsed", "id", sar.Id)
+
+	if !ss.admit(writer, request, ActionStore, sar.Id) {
+		return
+	}
+
+	// Stored as /sdp_fetch hands it out, so the policy covers fetched SDPs too
+	err = ss.rewriteClientSDP(sar.Id, PrincipalFromContext(request.Context()), clientSDP)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	release, ok := ss.reserveStoredSDP(writer)
+	if !ok {
+		return
+	}
+
+	ttl := ss.storedSDPTTL
+	if sar.TTL > 0 {
+		ttl = time.Duration(sar.TTL) * time.Second
+		// Compared in seconds first, a huge ttl overflows a Duration
+		if ss.maxStoredSDPTTL > 0 && (sar.TTL > int(ss.maxStoredSDPTTL/time.Second) || ttl > ss.maxStoredSDPTTL) {
+			ttl = ss.maxStoredSDPTTL
+		}
+	}
+
+	err = ss.storage.AddSDPToStorage(sar.Id, clientSDP.Base64(), sar.Data, ttl)
+	release(err == nil)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	stored := newEvent(request, EventSDPStored, sar.Id, sar.Data)
+	stored.SDP = clientSDP.Base64()
+	ss.observe(stored)
+
+	httpjson.Ok(writer, "success")
+}
+
+type sdpFetchResponse struct {
+	SDP       string            `json:"sdp"` // BASE64
+	Data      map[string]string `json:"data,omitempty"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+}
+
+func (ss *SignalingServer) sdpFetchHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeError(writer, ErrMethodNotAllowed)
+		return
+	}
+
+	id := request.URL.Query().Get("id")
+	if id == "" {
+		writeError(writer, ErrEmptyID)
+		return
+	}
+
+	if !ss.admit(writer, request, ActionFetch, id) {
+		return
+	}
+
+	var (
+		stored *StoredSDP
+		err    error
+	)
+
+	consume, _ := strconv.ParseBool(request.URL.Query().Get("consume"))
+	if consume {
+		stored, err = ss.storage.ConsumeSDPFromStorage(id)
+	} else {
+		stored, err = ss.storage.GetSDPFromStorage(id)
+	}
+
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	response := &sdpFetchResponse{SDP: stored.SDP.Base64(), Data: stored.SDP.Data()}
+	if !stored.ExpiresAt.IsZero() {
+		response.ExpiresAt = &stored.ExpiresAt
+	}
+
+	httpjson.Ok(writer, response)
+}
+
+func (ss *SignalingServer) candidateHandler(writer http.ResponseWriter, request *http.Request) {
+	var cr *candidateRequest
+
+	if !parseRequest(writer, request, &cr) {
+		return
+	}
+
+	err := cr.Validate()
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	if !ss.admit(writer, request, ActionCandidate, cr.Id) {
+		return
+	}
+
+	var l *Listener
+	l, err = ss.findCandidateListener(cr.Id, cr.Session)
 	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	ss.requestLogger(request.Context()).Debug("listener found", "id", cr.Id, "session", cr.Session)
+
+	// Candidates the policy drops are accepted all the same, the client cannot help them
+	if cr.Candidate != nil {
+		if candidate, keep := ss.filterTrickled(SDPFromClient, cr.Candidate); keep {
+			err = l.WriteClientCandidate(*candidate)
+			if err != nil {
+				writeError(writer, err)
+				return
+			}
+		}
+	}
+
+	if cr.EndOfCandidates {
+		err = l.WriteClientEndOfCandidates()
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+	}
+
+	httpjson.Ok(writer, "success")
+}
+
+func (ss *SignalingServer) candidatesPollHandler(writer http.ResponseWriter, request *http.Request) {
+	id := request.URL.Query().Get("id")
+	if id == "" {
+		writeError(writer, ErrEmptyID)
 		return
 	}
 
-	err = sar.Validate()
+	if !ss.admit(writer, request, ActionCandidate, id) {
+		return
+	}
+
+	l, err := ss.findCandidateListener(id, request.URL.Query().Get("session"))
 	if err != nil {
-		httpjson.BadRequest(writer, err.Error())
+		writeError(writer, err)
+		return
+	}
+
+	candidates := []*Candidate{}
+	for _, candidate := range l.PendingServerCandidates() {
+		filtered, keep := ss.filterTrickled(SDPFromServer, candidate.Candidate)
+		if keep {
+			candidates = append(candidates, &Candidate{Candidate: filtered, EndOfCandidates: candidate.EndOfCandidates})
+		}
+	}
+
+	httpjson.Ok(writer, candidates)
+}
+
+// findCandidateListener resolves the listener candidates of id are exchanged
+// on, the one of the given session for session listeners.
+func (ss *SignalingServer) findCandidateListener(id, session string) (l *Listener, err error) {
+	l, err = ss.storage.FindSDPListener(id)
+	if err != nil || session == "" {
 		return
 	}
 
-	err = ss.storage.AddSDPToStorage(sar.Id, sar.SDP, sar.Data)
+	var s *Session
+	s, err = l.Session(session)
 	if err != nil {
-		httpjson.BadRequest(writer, err.Error())
+		l = nil
 		return
 	}
+
+	l = s.Listener
+	return
 }
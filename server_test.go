@@ -0,0 +1,43 @@
+package webrtcsignalingserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignalingServer_SDPFetch(t *testing.T) {
+	ss := New()
+
+	recorder := httptest.NewRecorder()
+	body := `{"id":"stored","sdp":"` + testOfferBase64(t) + `","data":{"k":"v"}}`
+	ss.sdpStoreHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_store", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("store status = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{name: "empty_id", url: "/sdp_fetch", wantStatus: http.StatusBadRequest},
+		{name: "missing", url: "/sdp_fetch?id=missing", wantStatus: http.StatusNotFound},
+		{name: "fetch", url: "/sdp_fetch?id=stored", wantStatus: http.StatusOK},
+		{name: "consume", url: "/sdp_fetch?id=stored&consume=true", wantStatus: http.StatusOK},
+		{name: "consumed", url: "/sdp_fetch?id=stored", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ss.sdpFetchHandler(recorder, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(recorder.Body.String(), `"k":"v"`) {
+				t.Errorf("body = %s, want stored data", recorder.Body.String())
+			}
+		})
+	}
+}
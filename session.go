@@ -0,0 +1,255 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IdleSessionTTL is how long a session stays findable by id, for candidates,
+// after it was opened or last used, whatever its state. Forgotten sessions
+// stay open for their owner.
+const IdleSessionTTL = time.Minute
+
+// Session is one handshake made against a session listener. It has its own
+// listener, so candidates, messages and websocket frames of one client never
+// reach another.
+type Session struct {
+	*Listener
+
+	id        string
+	clientSDP *SDPClient
+	principal *Principal
+	createdAt time.Time
+
+	// Guarded by the sessionsM of the parent
+	usedAt time.Time
+}
+
+// NewSessionListener makes a listener that accepts any number of handshakes,
+// each delivered as a Session on Sessions(). Storage backends use it;
+// applications register one with AddSDPSessionListener.
+func NewSessionListener() (l *Listener) {
+	l = NewListener()
+	l.sessions = make(chan *Session)
+	l.sessionsByID = map[string]*Session{}
+	return
+}
+
+func (s *Session) Id() string {
+	return s.id
+}
+
+// SDP is the client SDP of the handshake. It is nil for websocket sessions,
+// their offers are read with ReadClientSDP like on any listener.
+func (s *Session) SDP() (sdp *webrtc.SessionDescription) {
+	if s.clientSDP != nil {
+		sdp = s.clientSDP.SDP()
+	}
+	return
+}
+
+func (s *Session) Data() (data map[string]string) {
+	if s.clientSDP != nil {
+		data = s.clientSDP.Data()
+	}
+	return
+}
+
+// Principal is who opened the session, nil when no Authenticator is set.
+func (s *Session) Principal() *Principal {
+	return s.principal
+}
+
+func (s *Session) CreatedAt() time.Time {
+	return s.createdAt
+}
+
+// Reply answers the handshake of this session.
+func (s *Session) Reply(sdp *webrtc.SessionDescription, data map[string]string) (err error) {
+	err = s.ReplyContext(context.Background(), sdp, data)
+	return
+}
+
+func (s *Session) ReplyContext(ctx context.Context, sdp *webrtc.SessionDescription, data map[string]string) (err error) {
+	err = s.WriteServerSDPContext(ctx, sdp, data)
+	return
+}
+
+func (l *Listener) IsSessionListener() bool {
+	return l.sessions != nil
+}
+
+// Sessions delivers every handshake made against a session listener. It is
+// closed when the listener is closed, and nil on other listeners.
+func (l *Listener) Sessions() <-chan *Session {
+	return l.sessions
+}
+
+// Session looks up a session that was not closed yet.
+func (l *Listener) Session(id string) (s *Session, err error) {
+	l.sessionsM.Lock()
+	defer l.sessionsM.Unlock()
+
+	var exists bool
+	s, exists = l.sessionsByID[id]
+	if !exists {
+		err = ErrSessionNotFound
+		return
+	}
+
+	s.usedAt = time.Now()
+	return
+}
+
+// DeliverClientSDPContext hands a client SDP to the owner of l and returns the
+// listener its answer will arrive on: l itself, or the listener of a new
+// Session when l is a session listener. Unless sdp is invalid, the returned
+// listener is set on failure as well, so callers can close the right one.
+func (l *Listener) DeliverClientSDPContext(ctx context.Context, sdp string, data map[string]string) (answers *Listener, err error) {
+	var clientSDP *SDPClient
+	clientSDP, err = NewClientSDP(sdp, data)
+	if err != nil {
+		return
+	}
+
+	answers, err = l.deliverClientSDP(ctx, clientSDP)
+	return
+}
+
+func (l *Listener) deliverClientSDP(ctx context.Context, clientSDP *SDPClient) (answers *Listener, err error) {
+	answers = l
+	if l.sessions == nil {
+		err = l.writeClientSDP(ctx, clientSDP)
+		return
+	}
+
+	clientSDP.principal = PrincipalFromContext(ctx)
+	clientSDP.requestID = RequestIDFromContext(ctx)
+	clientSDP.spanContext = trace.SpanContextFromContext(ctx)
+
+	var s *Session
+	s, err = l.openSession(ctx, clientSDP)
+	if s != nil {
+		answers = s.Listener
+	}
+
+	return
+}
+
+// openSession registers a new session and blocks until the owner takes it
+// from Sessions. A session that could not be delivered is closed.
+func (l *Listener) openSession(ctx context.Context, clientSDP *SDPClient) (s *Session, err error) {
+	var id string
+	id, err = newToken()
+	if err != nil {
+		return
+	}
+
+	s = &Session{
+		Listener:  NewListener(),
+		id:        id,
+		clientSDP: clientSDP,
+		principal: PrincipalFromContext(ctx),
+		createdAt: time.Now(),
+	}
+	s.parent = l
+	s.sessionID = s.id
+	s.usedAt = s.createdAt
+
+	l.sessionsM.Lock()
+	select {
+	case <-l.done:
+		l.sessionsM.Unlock()
+		err = l.closeErr
+		s = nil
+		return
+	default:
+	}
+	l.forgetIdleSessions(s.createdAt)
+	l.sessionsByID[s.id] = s
+	l.sessionsM.Unlock()
+
+	l.deliverM.RLock()
+	defer l.deliverM.RUnlock()
+
+	select {
+	case l.sessions <- s:
+		if clientSDP != nil {
+			s.Listener.setState(ListenerClientDelivered)
+		}
+		return
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-l.done:
+		err = l.closeErr
+	}
+
+	s.Close(err)
+	return
+}
+
+// sessionCount is how many sessions of l are open.
+func (l *Listener) sessionCount() int {
+	l.sessionsM.Lock()
+	defer l.sessionsM.Unlock()
+
+	return len(l.sessionsByID)
+}
+
+// touch marks the session l answers for as used, so it is not forgotten while
+// a websocket is still connected to it.
+func (l *Listener) touch() {
+	if l.parent == nil {
+		return
+	}
+
+	l.parent.sessionsM.Lock()
+	defer l.parent.sessionsM.Unlock()
+
+	if s, exists := l.parent.sessionsByID[l.sessionID]; exists && s.Listener == l {
+		s.usedAt = time.Now()
+	}
+}
+
+func (l *Listener) forgetSession(id string) {
+	l.sessionsM.Lock()
+	defer l.sessionsM.Unlock()
+
+	delete(l.sessionsByID, id)
+}
+
+// forgetIdleSessions forgets the sessions unused for IdleSessionTTL, answered
+// or not, so owners that never close sessions, e.g. of informs, do not grow
+// sessionsByID for the life of l. Called with sessionsM held.
+func (l *Listener) forgetIdleSessions(now time.Time) (forgotten int) {
+	for id, s := range l.sessionsByID {
+		if now.Sub(s.usedAt) >= IdleSessionTTL {
+			delete(l.sessionsByID, id)
+			forgotten++
+		}
+	}
+
+	return
+}
+
+// closeSessions runs once, after l.done is closed.
+func (l *Listener) closeSessions(err error) {
+	// Pending deliveries see l.done and give up the read lock
+	l.deliverM.Lock()
+	close(l.sessions)
+	l.deliverM.Unlock()
+
+	l.sessionsM.Lock()
+	sessions := make([]*Session, 0, len(l.sessionsByID))
+	for _, s := range l.sessionsByID {
+		sessions = append(sessions, s)
+	}
+	l.sessionsM.Unlock()
+
+	for _, s := range sessions {
+		s.Close(err)
+	}
+}
@@ -0,0 +1,232 @@
+package webrtcsignalingserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestSignalingServer_SessionListener(t *testing.T) {
+	ss := New(WithHandshakeTimeout(time.Second))
+	listener, err := ss.AddSDPSessionListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for session := range listener.Sessions() {
+			answer := &webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}
+			go session.Reply(answer, map[string]string{"viewer": session.Data()["viewer"]})
+		}
+	}()
+
+	const viewers = 3
+
+	responses := make([]*SDPServer, viewers)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < viewers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			body := `{"id":"publisher","sdp":"` + testOfferBase64(t) + `","data":{"viewer":"` + string(rune('a'+i)) + `"}}`
+			recorder := httptest.NewRecorder()
+			ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+			if recorder.Code != http.StatusOK {
+				t.Errorf("handshake %d status = %d %s", i, recorder.Code, recorder.Body.String())
+				return
+			}
+
+			var response struct {
+				Data *SDPServer `json:"data"`
+			}
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+			responses[i] = response.Data
+		}(i)
+	}
+	wg.Wait()
+
+	sessionIDs := map[string]bool{}
+	for i, response := range responses {
+		if response == nil {
+			t.FailNow()
+		}
+
+		if want := string(rune('a' + i)); response.Data["viewer"] != want {
+			t.Errorf("handshake %d answered for viewer %q, want %q", i, response.Data["viewer"], want)
+		}
+
+		if response.SessionId == "" || sessionIDs[response.SessionId] {
+			t.Errorf("handshake %d session id = %q, want a distinct id", i, response.SessionId)
+		}
+		sessionIDs[response.SessionId] = true
+	}
+
+	session, err := listener.Session(responses[0].SessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"id":"publisher","session":"` + session.Id() + `","candidate":{"candidate":"candidate:1"}}`
+	recorder := httptest.NewRecorder()
+	ss.candidateHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_candidate", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("candidate status = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if candidate := session.ReadClientCandidate(); candidate.Candidate.Candidate != "candidate:1" {
+		t.Errorf("ReadClientCandidate() = %+v", candidate)
+	}
+
+	if listener.clientCandidates.len() != 0 {
+		t.Error("a session candidate reached the session listener")
+	}
+
+	listener.Close(nil)
+
+	if _, open := <-listener.Sessions(); open {
+		t.Error("Sessions() still open after Close()")
+	}
+
+	if _, err = listener.Session(session.Id()); err == nil {
+		t.Error("Session() found a session of a closed listener")
+	}
+
+	if err = session.Reply(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}, nil); err == nil {
+		t.Error("Reply() on a session of a closed listener succeeded")
+	}
+}
+
+func TestSignalingServer_SessionListenerTimeout(t *testing.T) {
+	ss := New(WithHandshakeTimeout(50 * time.Millisecond))
+	listener, err := ss.AddSDPSessionListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"id":"publisher","sdp":"` + testOfferBase64(t) + `"}`
+
+	// Nobody takes the session
+	recorder := httptest.NewRecorder()
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+	if recorder.Code != http.StatusGatewayTimeout || !strings.Contains(recorder.Body.String(), "handshake_timeout") {
+		t.Fatalf("response = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// The listener keeps serving after a session timed out
+	go func() {
+		session := <-listener.Sessions()
+		session.Reply(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}, nil)
+	}()
+
+	recorder = httptest.NewRecorder()
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("response = %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	listener.sessionsM.Lock()
+	defer listener.sessionsM.Unlock()
+
+	if len(listener.sessionsByID) != 1 {
+		t.Errorf("%d sessions registered, want only the answered one", len(listener.sessionsByID))
+	}
+}
+
+func TestListener_ForgetIdleSessions(t *testing.T) {
+	listener := NewSessionListener()
+	defer listener.Close(nil)
+
+	go func() {
+		for session := range listener.Sessions() {
+			if session.Data()["answer"] == "yes" {
+				go session.Reply(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0\r\n"}, nil)
+			}
+		}
+	}()
+
+	open := func(answer string) *Session {
+		answers, err := listener.DeliverClientSDPContext(t.Context(), testOfferBase64(t), map[string]string{"answer": answer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Session{Listener: answers, id: answers.sessionID}
+	}
+
+	answered, pending, trickled := open("yes"), open("no"), open("yes")
+	if _, err := answered.ReadServerSDPContext(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trickled.ReadServerSDPContext(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reply marks the sessions answered once the SDP was read
+	for answered.State() != ListenerAnswered || trickled.State() != ListenerAnswered {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Only the trickled session was used since
+	later := time.Now().Add(IdleSessionTTL)
+	if _, err := listener.Session(trickled.id); err != nil {
+		t.Fatal(err)
+	}
+	listener.sessionsM.Lock()
+	listener.sessionsByID[trickled.id].usedAt = later
+	forgotten := listener.forgetIdleSessions(later)
+	listener.sessionsM.Unlock()
+
+	if forgotten != 2 {
+		t.Errorf("forgetIdleSessions() = %d, want 2", forgotten)
+	}
+	for _, s := range []*Session{answered, pending} {
+		if _, err := listener.Session(s.id); err != ErrSessionNotFound {
+			t.Errorf("Session() of an idle session = %v, want %v", err, ErrSessionNotFound)
+		}
+	}
+	if _, err := listener.Session(trickled.id); err != nil {
+		t.Errorf("Session(%s) = %v", trickled.id, err)
+	}
+}
+
+func TestListener_ForgetInformSessions(t *testing.T) {
+	ss := New()
+	listener, err := ss.AddSDPSessionListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close(nil)
+
+	// The owner takes every inform and never closes its session
+	go func() {
+		for range listener.Sessions() {
+		}
+	}()
+
+	offer := testOfferBase64(t)
+	for range 3 {
+		recorder := httptest.NewRecorder()
+		ss.sdpInformListenerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_inform", strings.NewReader(`{"id":"publisher","sdp":"`+offer+`"}`)))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("inform status = %d %s", recorder.Code, recorder.Body.String())
+		}
+	}
+
+	if count := listener.sessionCount(); count != 3 {
+		t.Fatalf("sessionCount() = %d, want 3", count)
+	}
+
+	listener.sessionsM.Lock()
+	listener.forgetIdleSessions(time.Now().Add(IdleSessionTTL))
+	listener.sessionsM.Unlock()
+
+	if count := listener.sessionCount(); count != 0 {
+		t.Errorf("sessionCount() after IdleSessionTTL = %d, want 0", count)
+	}
+}
@@ -0,0 +1,98 @@
+package webrtcsignalingserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Query parameters of a signed URL
+const (
+	SignedURLSubject   = "sub"
+	SignedURLID        = "signed_id"
+	SignedURLExpires   = "expires"
+	SignedURLSignature = "signature"
+)
+
+// HMACAuthenticator accepts URLs signed with SignURL, so a backend can hand
+// out links to the signaling endpoints without sharing a long-lived secret.
+type HMACAuthenticator struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func NewHMACAuthenticator(secret []byte) *HMACAuthenticator {
+	return &HMACAuthenticator{secret: secret, now: time.Now}
+}
+
+// SignURL adds subject, id, expiry and signature to u for the given method.
+// Every other query parameter is covered by the signature as well. The URL
+// is only good for the listener, stored SDP or room id, see Authorize.
+func (ha *HMACAuthenticator) SignURL(method string, u *url.URL, subject, id string, expires time.Time) *url.URL {
+	signed := *u
+
+	query := signed.Query()
+	query.Del(SignedURLSignature)
+	query.Set(SignedURLSubject, subject)
+	query.Set(SignedURLID, id)
+	query.Set(SignedURLExpires, strconv.FormatInt(expires.Unix(), 10))
+	query.Set(SignedURLSignature, ha.sign(method, signed.Path, query))
+
+	signed.RawQuery = query.Encode()
+	return &signed
+}
+
+func (ha *HMACAuthenticator) Authenticate(request *http.Request) (principal *Principal, err error) {
+	query := request.URL.Query()
+
+	signature, err := hex.DecodeString(query.Get(SignedURLSignature))
+	if err != nil || len(signature) == 0 {
+		err = ErrMissingCredentials
+		return
+	}
+
+	query.Del(SignedURLSignature)
+	expected, _ := hex.DecodeString(ha.sign(request.Method, request.URL.Path, query))
+	if !hmac.Equal(signature, expected) {
+		err = ErrInvalidSignature
+		return
+	}
+
+	expires, err := strconv.ParseInt(query.Get(SignedURLExpires), 10, 64)
+	if err != nil || !ha.now().Before(time.Unix(expires, 0)) {
+		err = ErrSignatureExpired
+		return
+	}
+
+	principal = &Principal{Subject: query.Get(SignedURLSubject), Method: "hmac"}
+	if id := query.Get(SignedURLID); id != "" {
+		principal.Audience = []string{id}
+	}
+	return
+}
+
+// Authorize lets principal act on the id its URL was signed for only. The id
+// of POST endpoints is in the body, which the signature does not cover.
+func (ha *HMACAuthenticator) Authorize(principal *Principal, action Action, id string) (err error) {
+	if principal == nil {
+		err = ErrMissingCredentials
+		return
+	}
+
+	if !slices.Contains(principal.Audience, id) {
+		err = ErrSignatureNotValidForID
+	}
+	return
+}
+
+// sign covers method, path and the sorted query without the signature.
+func (ha *HMACAuthenticator) sign(method, path string, query url.Values) string {
+	mac := hmac.New(sha256.New, ha.secret)
+	mac.Write([]byte(method + "\n" + path + "\n" + query.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
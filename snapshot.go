@@ -0,0 +1,90 @@
+package webrtcsignalingserver
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	SDPs      []*SDPRecord `json:"sdps"`
+}
+
+// Snapshot writes every stored SDP to w as JSON, so Restore can load them on
+// another host. Listeners are bound to this process and are not included.
+func (ss *SignalingServer) Snapshot(w io.Writer) (err error) {
+	var ids []string
+	ids, err = ss.storage.ListSDPsInStorage()
+	if err != nil {
+		return
+	}
+
+	s := &snapshot{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now(),
+		SDPs:      make([]*SDPRecord, 0, len(ids)),
+	}
+
+	for _, id := range ids {
+		stored, getErr := ss.storage.GetSDPFromStorage(id)
+		if getErr != nil {
+			// Expired or consumed since it was listed
+			continue
+		}
+
+		s.SDPs = append(s.SDPs, stored.Record(id))
+	}
+
+	err = json.NewEncoder(w).Encode(s)
+	return
+}
+
+// Restore loads a Snapshot into storage, replacing entries with the same id.
+// Entries that expired in the meantime are skipped. Nothing is loaded if any
+// entry is invalid.
+func (ss *SignalingServer) Restore(r io.Reader) (err error) {
+	var s *snapshot
+	err = json.NewDecoder(r).Decode(&s)
+	if err != nil {
+		err = wrapError(ErrInvalidJSON, err)
+		return
+	}
+
+	if s == nil || s.Version != snapshotVersion {
+		err = ErrUnsupportedSnapshot
+		return
+	}
+
+	// Every record is checked before the first import, so a bad snapshot
+	// leaves storage as it was
+	stored := make([]*StoredSDP, len(s.SDPs))
+	for i, record := range s.SDPs {
+		if record == nil || record.Id == "" {
+			err = ErrEmptyID
+			return
+		}
+
+		stored[i], err = record.StoredSDP()
+		if err != nil {
+			return
+		}
+	}
+
+	now := time.Now()
+	for i, record := range s.SDPs {
+		if stored[i].Expired(now) {
+			continue
+		}
+
+		err = ss.storage.ImportSDPToStorage(record.Id, stored[i])
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
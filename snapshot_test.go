@@ -0,0 +1,75 @@
+package webrtcsignalingserver
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignalingServer_SnapshotRestore(t *testing.T) {
+	source := New()
+	offer := testOfferBase64(t)
+
+	if err := source.storage.AddSDPToStorage("kept", offer, map[string]string{"k": "v"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.storage.AddSDPToStorage("expiring", offer, nil, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	target := New()
+	if err := target.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, _ := target.storage.ListSDPsInStorage()
+	if len(ids) != 1 || ids[0] != "kept" {
+		t.Fatalf("restored ids = %v, want [kept]", ids)
+	}
+
+	want, _ := source.storage.GetSDPFromStorage("kept")
+	got, _ := target.storage.GetSDPFromStorage("kept")
+	if got.SDP.Base64() != want.SDP.Base64() || got.SDP.Data()["k"] != "v" || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("restored entry = %+v, want %+v", got, want)
+	}
+}
+
+func TestSignalingServer_RestoreInvalid(t *testing.T) {
+	offer := testOfferBase64(t)
+	future := time.Now().Add(time.Hour)
+
+	snapshot := `{"version":1,"sdps":[` +
+		`{"id":"first","sdp":"` + offer + `","expires_at":"` + future.Format(time.RFC3339) + `"},` +
+		`{"id":"broken","sdp":"%%%","expires_at":"` + future.Format(time.RFC3339) + `"}]}`
+
+	target := New()
+	if err := target.Restore(strings.NewReader(snapshot)); !errors.Is(err, ErrInvalidSDP) {
+		t.Fatalf("Restore() = %v, want %v", err, ErrInvalidSDP)
+	}
+
+	if ids, _ := target.storage.ListSDPsInStorage(); len(ids) != 0 {
+		t.Errorf("restored ids = %v, want none from an invalid snapshot", ids)
+	}
+}
+
+func TestSignalingServer_RestoreVersion(t *testing.T) {
+	target := New()
+
+	err := target.Restore(strings.NewReader(`{"version":2,"sdps":[]}`))
+	if !errors.Is(err, ErrUnsupportedSnapshot) {
+		t.Errorf("Restore() of version 2 = %v, want %v", err, ErrUnsupportedSnapshot)
+	}
+
+	if err = target.Restore(strings.NewReader(`{`)); !errors.Is(err, ErrInvalidJSON) {
+		t.Errorf("Restore() of broken JSON = %v, want %v", err, ErrInvalidJSON)
+	}
+}
@@ -0,0 +1,84 @@
+package webrtcsignalingserver
+
+import "time"
+
+// Storage keeps the listeners registered on a SignalingServer and the SDPs
+// posted to /sdp_store. Listeners hold channels, so they always live in the
+// process that registered them; backends that persist SDPs elsewhere usually
+// keep listeners in an embedded MemoryStorage.
+//
+// Every implementation must pass storagetest.Run.
+type Storage interface {
+	AddSDPListener(id string) (l *Listener, err error)
+	// AddSDPSessionListener registers a listener made by NewSessionListener.
+	AddSDPSessionListener(id string) (l *Listener, err error)
+	// GetSDPListener hands a listener out once; later calls fail until the id is registered again.
+	// Session listeners are handed out every time.
+	GetSDPListener(id string) (l *Listener, err error)
+	// FindSDPListener looks a listener up without consuming it.
+	FindSDPListener(id string) (l *Listener, err error)
+	RemoveSDPListener(id string) (err error)
+	ListSDPListeners() (ids []string, err error)
+
+	// AddSDPToStorage keeps sdp for ttl, a zero ttl never expires.
+	AddSDPToStorage(id, sdp string, data map[string]string, ttl time.Duration) (err error)
+	GetSDPFromStorage(id string) (sdp *StoredSDP, err error)
+	ConsumeSDPFromStorage(id string) (sdp *StoredSDP, err error)
+	DeleteSDPFromStorage(id string) (err error)
+	ListSDPsInStorage() (ids []string, err error)
+	// ImportSDPToStorage keeps sdp with its own timestamps, replacing whatever id held.
+	// Already expired entries are dropped.
+	ImportSDPToStorage(id string, sdp *StoredSDP) (err error)
+
+	Close() (err error)
+}
+
+type StoredSDP struct {
+	SDP       *SDPClient
+	CreatedAt time.Time
+	ExpiresAt time.Time // Zero means the entry never expires
+}
+
+func (s *StoredSDP) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
+}
+
+// size is the length of the SDP, as reported by StoredSizer.
+func (s *StoredSDP) size() int64 {
+	return int64(len(s.SDP.sdp.SDP))
+}
+
+func (s *StoredSDP) Record(id string) *SDPRecord {
+	return &SDPRecord{
+		Id:        id,
+		SDP:       s.SDP.Base64(),
+		Data:      s.SDP.Data(),
+		CreatedAt: s.CreatedAt,
+		ExpiresAt: s.ExpiresAt,
+	}
+}
+
+// SDPRecord is how a StoredSDP is written outside the process, by storage
+// backends and snapshots.
+type SDPRecord struct {
+	Id        string            `json:"id,omitempty"`
+	SDP       string            `json:"sdp"` // BASE64
+	Data      map[string]string `json:"data,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+func (r *SDPRecord) StoredSDP() (sdp *StoredSDP, err error) {
+	var clientSDP *SDPClient
+	clientSDP, err = NewClientSDP(r.SDP, r.Data)
+	if err != nil {
+		return
+	}
+
+	sdp = &StoredSDP{
+		SDP:       clientSDP,
+		CreatedAt: r.CreatedAt,
+		ExpiresAt: r.ExpiresAt,
+	}
+	return
+}
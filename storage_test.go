@@ -0,0 +1,14 @@
+package webrtcsignalingserver_test
+
+import (
+	"testing"
+
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/aliforever/go-webrtc-signaling-server/storagetest"
+)
+
+func TestMemoryStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) webrtcsignalingserver.Storage {
+		return webrtcsignalingserver.NewMemoryStorage(webrtcsignalingserver.DefaultSweepInterval)
+	})
+}
@@ -0,0 +1,319 @@
+// Package storagetest holds the conformance suite every
+// webrtcsignalingserver.Storage implementation has to pass.
+package storagetest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	webrtcsignalingserver "github.com/aliforever/go-webrtc-signaling-server"
+	"github.com/pion/webrtc/v3"
+)
+
+// Run checks storage semantics against fresh storages made by newStorage.
+// Storages are closed by the suite.
+func Run(t *testing.T, newStorage func(t *testing.T) webrtcsignalingserver.Storage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, storage webrtcsignalingserver.Storage)
+	}{
+		{name: "ListenerLifecycle", run: testListenerLifecycle},
+		{name: "ListenerReRegister", run: testListenerReRegister},
+		{name: "ListListeners", run: testListListeners},
+		{name: "SessionListener", run: testSessionListener},
+		{name: "SDPLifecycle", run: testSDPLifecycle},
+		{name: "SDPConsume", run: testSDPConsume},
+		{name: "SDPInvalidBase64", run: testSDPInvalidBase64},
+		{name: "SDPExpiry", run: testSDPExpiry},
+		{name: "ListSDPs", run: testListSDPs},
+		{name: "ImportSDP", run: testImportSDP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newStorage(t)
+			defer storage.Close()
+
+			tt.run(t, storage)
+		})
+	}
+}
+
+// OfferSDP is the smallest offer webrtcsignalingserver.ParseSDP accepts.
+const OfferSDP = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n" +
+	"a=fingerprint:sha-256 E6:32:0F:C2:21:A8:C1:C7:8C:AA:24:A8:F7:49:D5:3A:22:88:68:58:82:37:EA:C9:B0:33:1E:62:62:5F:0B:FA\r\n" +
+	"m=application 9 UDP/DTLS/SCTP webrtc-datachannel\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=ice-ufrag:sMbxeGwbcSAFhgEf\r\n" +
+	"a=ice-pwd:piRMgOyfeyBThjzuaAOxrdUedsOYSmlt\r\n" +
+	"a=mid:0\r\n" +
+	"a=sctp-port:5000\r\n"
+
+// OfferBase64 is OfferSDP encoded the way the endpoints take SDPs.
+func OfferBase64(t *testing.T) string {
+	offer, err := webrtcsignalingserver.EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: OfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offer
+}
+
+func testListenerLifecycle(t *testing.T, storage webrtcsignalingserver.Storage) {
+	added, err := storage.AddSDPListener("publisher")
+	if err != nil || added == nil {
+		t.Fatalf("AddSDPListener() = %v, %v", added, err)
+	}
+
+	if _, err = storage.AddSDPListener("publisher"); !errors.Is(err, webrtcsignalingserver.ErrListenerExists) {
+		t.Errorf("AddSDPListener() on a registered id error = %v, want %v", err, webrtcsignalingserver.ErrListenerExists)
+	}
+
+	got, err := storage.GetSDPListener("publisher")
+	if err != nil || got != added {
+		t.Fatalf("GetSDPListener() = %v, %v, want the added listener", got, err)
+	}
+
+	if _, err = storage.GetSDPListener("publisher"); err == nil {
+		t.Error("GetSDPListener() handed the same listener out twice")
+	}
+
+	found, err := storage.FindSDPListener("publisher")
+	if err != nil || found != added {
+		t.Errorf("FindSDPListener() after GetSDPListener() = %v, %v", found, err)
+	}
+
+	if err = storage.RemoveSDPListener("publisher"); err != nil {
+		t.Errorf("RemoveSDPListener() error = %v", err)
+	}
+
+	if _, err = storage.FindSDPListener("publisher"); err == nil {
+		t.Error("FindSDPListener() found a removed listener")
+	}
+
+	if err = storage.RemoveSDPListener("publisher"); !errors.Is(err, webrtcsignalingserver.ErrListenerNotFound) {
+		t.Errorf("RemoveSDPListener() on a missing id error = %v, want %v", err, webrtcsignalingserver.ErrListenerNotFound)
+	}
+
+	if _, err = storage.GetSDPListener("missing"); !errors.Is(err, webrtcsignalingserver.ErrListenerNotFound) {
+		t.Errorf("GetSDPListener() on a missing id error = %v, want %v", err, webrtcsignalingserver.ErrListenerNotFound)
+	}
+}
+
+func testListenerReRegister(t *testing.T, storage webrtcsignalingserver.Storage) {
+	first, err := storage.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = storage.GetSDPListener("publisher"); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := storage.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatalf("AddSDPListener() after the listener was consumed error = %v", err)
+	}
+
+	if second == first {
+		t.Error("AddSDPListener() returned the consumed listener")
+	}
+
+	if got, err := storage.GetSDPListener("publisher"); err != nil || got != second {
+		t.Errorf("GetSDPListener() = %v, %v, want the new listener", got, err)
+	}
+}
+
+func testSessionListener(t *testing.T, storage webrtcsignalingserver.Storage) {
+	added, err := storage.AddSDPSessionListener("publisher")
+	if err != nil || added == nil || !added.IsSessionListener() {
+		t.Fatalf("AddSDPSessionListener() = %v, %v", added, err)
+	}
+
+	if _, err = storage.AddSDPListener("publisher"); err == nil {
+		t.Error("AddSDPListener() on an id held by a session listener succeeded")
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := storage.GetSDPListener("publisher")
+		if err != nil || got != added {
+			t.Fatalf("GetSDPListener() call %d = %v, %v, want the session listener", i+1, got, err)
+		}
+	}
+
+	if err = storage.RemoveSDPListener("publisher"); err != nil {
+		t.Errorf("RemoveSDPListener() error = %v", err)
+	}
+
+	if _, err = storage.GetSDPListener("publisher"); err == nil {
+		t.Error("GetSDPListener() found a removed session listener")
+	}
+}
+
+func testListListeners(t *testing.T, storage webrtcsignalingserver.Storage) {
+	for _, id := range []string{"b", "a"} {
+		if _, err := storage.AddSDPListener(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := storage.ListSDPListeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"a", "b"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ListSDPListeners() = %v, want %v", ids, want)
+	}
+}
+
+func testSDPLifecycle(t *testing.T, storage webrtcsignalingserver.Storage) {
+	offer := OfferBase64(t)
+	data := map[string]string{"k": "v"}
+
+	if err := storage.AddSDPToStorage("stored", offer, data, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.AddSDPToStorage("stored", offer, nil, time.Minute); !errors.Is(err, webrtcsignalingserver.ErrSDPExists) {
+		t.Errorf("AddSDPToStorage() on a stored id error = %v, want %v", err, webrtcsignalingserver.ErrSDPExists)
+	}
+
+	stored, err := storage.GetSDPFromStorage("stored")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.SDP.Base64() != offer || !reflect.DeepEqual(stored.SDP.Data(), data) {
+		t.Errorf("GetSDPFromStorage() = %s %v, want %s %v", stored.SDP.Base64(), stored.SDP.Data(), offer, data)
+	}
+
+	if stored.SDP.SDP() == nil || stored.SDP.SDP().Type != webrtc.SDPTypeOffer {
+		t.Errorf("GetSDPFromStorage() decoded SDP = %v", stored.SDP.SDP())
+	}
+
+	if stored.CreatedAt.IsZero() || !stored.ExpiresAt.After(stored.CreatedAt) {
+		t.Errorf("GetSDPFromStorage() timestamps = %v, %v", stored.CreatedAt, stored.ExpiresAt)
+	}
+
+	if _, err = storage.GetSDPFromStorage("stored"); err != nil {
+		t.Error("GetSDPFromStorage() removed the entry")
+	}
+
+	if err = storage.DeleteSDPFromStorage("stored"); err != nil {
+		t.Errorf("DeleteSDPFromStorage() error = %v", err)
+	}
+
+	if _, err = storage.GetSDPFromStorage("stored"); !errors.Is(err, webrtcsignalingserver.ErrSDPNotFound) {
+		t.Errorf("GetSDPFromStorage() of a deleted entry error = %v, want %v", err, webrtcsignalingserver.ErrSDPNotFound)
+	}
+
+	if err = storage.DeleteSDPFromStorage("stored"); !errors.Is(err, webrtcsignalingserver.ErrSDPNotFound) {
+		t.Errorf("DeleteSDPFromStorage() on a missing id error = %v, want %v", err, webrtcsignalingserver.ErrSDPNotFound)
+	}
+}
+
+func testSDPConsume(t *testing.T, storage webrtcsignalingserver.Storage) {
+	if err := storage.AddSDPToStorage("stored", OfferBase64(t), nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := storage.ConsumeSDPFromStorage("stored")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stored.ExpiresAt.IsZero() {
+		t.Errorf("ConsumeSDPFromStorage() ExpiresAt = %v for a zero ttl", stored.ExpiresAt)
+	}
+
+	if _, err = storage.ConsumeSDPFromStorage("stored"); err == nil {
+		t.Error("ConsumeSDPFromStorage() handed the same entry out twice")
+	}
+}
+
+func testSDPInvalidBase64(t *testing.T, storage webrtcsignalingserver.Storage) {
+	if err := storage.AddSDPToStorage("stored", "not base64", nil, time.Minute); err == nil {
+		t.Error("AddSDPToStorage() accepted an invalid SDP")
+	}
+
+	if _, err := storage.GetSDPFromStorage("stored"); err == nil {
+		t.Error("GetSDPFromStorage() found a rejected entry")
+	}
+}
+
+func testSDPExpiry(t *testing.T, storage webrtcsignalingserver.Storage) {
+	offer := OfferBase64(t)
+
+	if err := storage.AddSDPToStorage("stored", offer, nil, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := storage.GetSDPFromStorage("stored"); err == nil {
+		t.Error("GetSDPFromStorage() returned an expired entry")
+	}
+
+	if err := storage.AddSDPToStorage("stored", offer, nil, time.Minute); err != nil {
+		t.Errorf("AddSDPToStorage() over an expired entry error = %v", err)
+	}
+}
+
+func testListSDPs(t *testing.T, storage webrtcsignalingserver.Storage) {
+	offer := OfferBase64(t)
+
+	for _, id := range []string{"b", "a"} {
+		if err := storage.AddSDPToStorage(id, offer, nil, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := storage.ListSDPsInStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"a", "b"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ListSDPsInStorage() = %v, want %v", ids, want)
+	}
+}
+
+func testImportSDP(t *testing.T, storage webrtcsignalingserver.Storage) {
+	clientSDP, err := webrtcsignalingserver.NewClientSDP(OfferBase64(t), map[string]string{"k": "v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+	imported := &webrtcsignalingserver.StoredSDP{SDP: clientSDP, CreatedAt: createdAt, ExpiresAt: time.Now().Add(time.Hour)}
+
+	if err = storage.AddSDPToStorage("stored", OfferBase64(t), nil, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = storage.ImportSDPToStorage("stored", imported); err != nil {
+		t.Fatalf("ImportSDPToStorage() error = %v", err)
+	}
+
+	stored, err := storage.GetSDPFromStorage("stored")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stored.CreatedAt.Equal(createdAt) || stored.SDP.Data()["k"] != "v" {
+		t.Errorf("GetSDPFromStorage() = %v %v, want the imported entry", stored.CreatedAt, stored.SDP.Data())
+	}
+
+	expired := &webrtcsignalingserver.StoredSDP{SDP: clientSDP, CreatedAt: createdAt, ExpiresAt: time.Now().Add(-time.Minute)}
+	if err = storage.ImportSDPToStorage("expired", expired); err != nil {
+		t.Fatalf("ImportSDPToStorage() of an expired entry error = %v", err)
+	}
+
+	if _, err = storage.GetSDPFromStorage("expired"); err == nil {
+		t.Error("GetSDPFromStorage() found an entry imported already expired")
+	}
+}
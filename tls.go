@@ -0,0 +1,186 @@
+package webrtcsignalingserver
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often CertReloader looks at its files at most.
+const certReloadInterval = time.Second
+
+// CertReloader serves a certificate from files and loads it again once either
+// file changes, so renewed certificates are picked up without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	checked time.Time
+	m       sync.Mutex
+}
+
+// NewCertReloader loads the PEM encoded certificate and key of certFile and
+// keyFile, which have to be valid right away.
+func NewCertReloader(certFile, keyFile string) (cr *CertReloader, err error) {
+	cr = &CertReloader{certFile: certFile, keyFile: keyFile}
+
+	err = cr.load()
+	if err != nil {
+		cr = nil
+	}
+
+	return
+}
+
+func (cr *CertReloader) load() (err error) {
+	var certInfo, keyInfo os.FileInfo
+	certInfo, err = os.Stat(cr.certFile)
+	if err != nil {
+		return
+	}
+
+	keyInfo, err = os.Stat(cr.keyFile)
+	if err != nil {
+		return
+	}
+
+	var cert tls.Certificate
+	cert, err = tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return
+	}
+
+	cr.cert, cr.certMod, cr.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	return
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate. While a changed pair
+// fails to load, e.g. because only one of the files was replaced yet, the
+// previous certificate is kept.
+func (cr *CertReloader) GetCertificate(_ *tls.ClientHelloInfo) (cert *tls.Certificate, err error) {
+	cr.m.Lock()
+	defer cr.m.Unlock()
+
+	if now := time.Now(); now.Sub(cr.checked) >= certReloadInterval {
+		cr.checked = now
+		if cr.changed() {
+			cr.load()
+		}
+	}
+
+	cert = cr.cert
+	return
+}
+
+func (cr *CertReloader) changed() bool {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return false
+	}
+
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return false
+	}
+
+	return !certInfo.ModTime().Equal(cr.certMod) || !keyInfo.ModTime().Equal(cr.keyMod)
+}
+
+// ListenTLS is Listen over TLS, serving the certificate of certFile and
+// keyFile and reloading it whenever the files change. The tls.Config of
+// WithTLSConfig, if any, is used for everything else.
+func (ss *SignalingServer) ListenTLS(address, certFile, keyFile string) (server *http.Server, err error) {
+	var reloader *CertReloader
+	reloader, err = NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return
+	}
+
+	config := ss.serverTLSConfig()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.GetCertificate = reloader.GetCertificate
+
+	server = &http.Server{Addr: address, Handler: ss.Handler(), TLSConfig: config}
+
+	ss.lifecycle.m.Lock()
+	if ss.lifecycle.server == nil {
+		// Lets Shutdown stop it as well
+		ss.lifecycle.server = server
+		ss.lifecycle.tls = true
+	}
+	ss.lifecycle.m.Unlock()
+
+	// The certificate comes from GetCertificate
+	err = server.ListenAndServeTLS("", "")
+
+	return
+}
+
+// serverTLSConfig is the tls.Config Start and ListenTLS serve with, nil when
+// neither WithTLSConfig nor WithClientCertificates was used.
+func (ss *SignalingServer) serverTLSConfig() (config *tls.Config) {
+	if ss.tlsConfig == nil && ss.clientCAs == nil {
+		return
+	}
+
+	config = &tls.Config{MinVersion: tls.VersionTLS12}
+	if ss.tlsConfig != nil {
+		config = ss.tlsConfig.Clone()
+	}
+
+	if ss.clientCAs != nil {
+		config.ClientCAs = ss.clientCAs
+		// Browsers have no certificate, ClientCertAuthenticator decides per request
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return
+}
+
+// ClientCertAuthenticator accepts requests made with a client certificate
+// verified against the pool of WithClientCertificates, e.g. by backend media
+// servers. The principal's subject is the certificate's common name.
+type ClientCertAuthenticator struct {
+	subjects map[string]bool
+}
+
+// NewClientCertAuthenticator accepts every verified certificate, or with
+// subjects only those with one of these common names.
+func NewClientCertAuthenticator(subjects ...string) *ClientCertAuthenticator {
+	ca := &ClientCertAuthenticator{}
+	if len(subjects) > 0 {
+		ca.subjects = make(map[string]bool, len(subjects))
+		for _, subject := range subjects {
+			ca.subjects[subject] = true
+		}
+	}
+
+	return ca
+}
+
+func (ca *ClientCertAuthenticator) Authenticate(request *http.Request) (principal *Principal, err error) {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+		err = ErrMissingCredentials
+		return
+	}
+
+	leaf := request.TLS.VerifiedChains[0][0]
+	if ca.subjects != nil && !ca.subjects[leaf.Subject.CommonName] {
+		err = ErrInvalidCredentials
+		return
+	}
+
+	principal = &Principal{
+		Subject: leaf.Subject.CommonName,
+		Method:  "client_certificate",
+		Claims:  map[string]string{"serial": leaf.SerialNumber.String()},
+	}
+	return
+}
@@ -0,0 +1,171 @@
+package webrtcsignalingserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate issues a certificate for commonName, signed by parent or
+// self-signed when parent is nil.
+func testCertificate(t *testing.T, commonName string, serial int64, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writeTestCertificate(t *testing.T, cert tls.Certificate, certFile, keyFile string, modTime time.Time) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	for file, content := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err = os.WriteFile(file, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	writeTestCertificate(t, testCertificate(t, "first", 1, nil), certFile, keyFile, time.Now().Add(-time.Minute))
+
+	cr, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := cr.GetCertificate(nil)
+	if err != nil || cert.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("GetCertificate() = %v, want the first certificate", err)
+	}
+
+	writeTestCertificate(t, testCertificate(t, "second", 2, nil), certFile, keyFile, time.Now())
+
+	// Pretend the files were last looked at long ago
+	cr.m.Lock()
+	cr.checked = time.Time{}
+	cr.m.Unlock()
+
+	cert, err = cr.GetCertificate(nil)
+	if err != nil || cert.Leaf.Subject.CommonName != "second" {
+		t.Fatalf("GetCertificate() = %v, want the renewed certificate", err)
+	}
+
+	// A half written pair keeps the current certificate
+	if err = os.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cr.m.Lock()
+	cr.checked = time.Time{}
+	cr.m.Unlock()
+
+	cert, err = cr.GetCertificate(nil)
+	if err != nil || cert.Leaf.Subject.CommonName != "second" {
+		t.Fatalf("GetCertificate() = %v, want the renewed certificate kept", err)
+	}
+}
+
+func TestSignalingServer_MutualTLS(t *testing.T) {
+	ca := testCertificate(t, "ca", 1, nil)
+	serverCert := testCertificate(t, "server", 2, &ca)
+	backendCert := testCertificate(t, "media-server", 3, &ca)
+	strangerCA := testCertificate(t, "stranger-ca", 4, nil)
+	strangerCert := testCertificate(t, "media-server", 5, &strangerCA)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	ss := New(
+		WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{serverCert}}),
+		WithClientCertificates(pool),
+		WithAuthenticator(NewClientCertAuthenticator("media-server")),
+	)
+	if err := ss.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Shutdown(t.Context())
+
+	get := func(certificates ...tls.Certificate) (int, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: certificates,
+		}}}
+
+		response, err := client.Get("https://" + ss.Addr().String() + "/sdp_fetch?id=missing")
+		if err != nil {
+			return 0, err
+		}
+		response.Body.Close()
+		return response.StatusCode, nil
+	}
+
+	if code, err := get(backendCert); err != nil || code != http.StatusNotFound {
+		t.Errorf("fetch with a client certificate = %d, %v, want it past authentication", code, err)
+	}
+
+	if code, err := get(); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("fetch without a client certificate = %d, %v, want 401", code, err)
+	}
+
+	// Clients leave out certificates of CAs the server does not ask for
+	if code, err := get(strangerCert); err == nil && code != http.StatusUnauthorized {
+		t.Errorf("fetch with a certificate of another CA = %d, want it rejected", code)
+	}
+}
@@ -0,0 +1,92 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/aliforever/go-webrtc-signaling-server"
+
+// Stages of a handshake, each traced as a span of its own under the span of
+// the request.
+const (
+	SpanParse         = "parse"
+	SpanValidate      = "validate"
+	SpanLookup        = "lookup_listener"
+	SpanDeliver       = "deliver"
+	SpanWaitForAnswer = "wait_for_answer"
+	SpanRespond       = "respond"
+)
+
+// newTracer is the server's tracer from provider, the global one when nil.
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// trace runs every request to endpoint in a server span, continuing the trace
+// of its W3C traceparent header if it has one.
+func (ss *SignalingServer) trace(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	propagator := propagation.TraceContext{}
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		ctx := propagator.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := ss.tracer.Start(ctx, endpoint,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", request.Method),
+				attribute.String("signaling.request_id", RequestIDFromContext(ctx)),
+			),
+		)
+		defer span.End()
+
+		handler(writer, request.WithContext(ctx))
+
+		// correlate records every response, see wrap
+		if recorder, ok := writer.(*statusRecorder); ok {
+			span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+			if recorder.err != nil {
+				failSpan(span, recorder.err)
+			}
+		}
+	}
+}
+
+// endStage ends the span of a stage that ended with err.
+func endStage(span trace.Span, err error) {
+	if err != nil {
+		failSpan(span, err)
+	}
+	span.End()
+}
+
+func failSpan(span trace.Span, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = ErrInternal
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, string(e.code))
+}
+
+// TraceContext is parent continuing the trace of the request that sent the
+// SDP, for the code answering it to trace under.
+func (sc *SDPClient) TraceContext(parent context.Context) context.Context {
+	return trace.ContextWithRemoteSpanContext(parent, sc.spanContext)
+}
+
+// SpanContext is the span the SDP was delivered in, invalid when the request
+// was not traced.
+func (sc *SDPClient) SpanContext() trace.SpanContext {
+	return sc.spanContext
+}
@@ -0,0 +1,96 @@
+package webrtcsignalingserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSignalingServer_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ss := New(WithTracerProvider(provider))
+
+	server := httptest.NewServer(ss.Handler())
+	defer server.Close()
+
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answered := make(chan trace.SpanContext, 1)
+	go func() {
+		clientSDP, err := listener.ReadSDPClientContext(t.Context())
+		if err != nil {
+			return
+		}
+
+		// The answering code continues the trace of the handshake
+		_, span := provider.Tracer("answerer").Start(clientSDP.TraceContext(t.Context()), "answer")
+		span.End()
+		answered <- span.SpanContext()
+
+		listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testOfferSDP}, nil)
+	}()
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/sdp_handshake", strings.NewReader(`{"id":"publisher","sdp":"`+offer+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("handshake = %d", response.StatusCode)
+	}
+
+	answer := <-answered
+	if answer.TraceID().String() != traceID {
+		t.Errorf("answer span trace = %s, want %s", answer.TraceID(), traceID)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	root, ok := spans["sdp_handshake"]
+	if !ok || root.SpanKind != trace.SpanKindServer || root.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("no server span continuing the traceparent in %v", spans)
+	}
+
+	for _, name := range []string{SpanParse, SpanValidate, SpanLookup, SpanDeliver, SpanWaitForAnswer, SpanRespond} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+
+		if span.SpanContext.TraceID().String() != traceID || span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("%s span is not a child of the request span", name)
+		}
+	}
+
+	if parent := spans["answer"].Parent.SpanID(); parent != spans[SpanDeliver].SpanContext.SpanID() {
+		t.Errorf("answer span parent = %s, want the %s span", parent, SpanDeliver)
+	}
+}
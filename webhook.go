@@ -0,0 +1,407 @@
+package webrtcsignalingserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// body under the webhook secret, see VerifyWebhookSignature.
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// WebhookEventHeader carries the EventType of the payload.
+	WebhookEventHeader = "X-Webhook-Event"
+	// WebhookAttemptHeader counts the attempts at a delivery, from 1.
+	WebhookAttemptHeader = "X-Webhook-Attempt"
+	// WebhookTimestampHeader carries the Unix time of the attempt in seconds.
+	// It is signed with the body, so receivers can refuse replays.
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+)
+
+const (
+	DefaultWebhookQueueSize   = 1024
+	DefaultWebhookWorkers     = 4
+	DefaultWebhookMaxAttempts = 5
+	DefaultWebhookBackoff     = 500 * time.Millisecond
+	DefaultWebhookMaxBackoff  = 30 * time.Second
+	DefaultWebhookDeadLetters = 1000
+	// DefaultWebhookMaxAge is a tolerance for VerifyWebhookSignature.
+	DefaultWebhookMaxAge = 5 * time.Minute
+)
+
+// WebhookPayload is the JSON body POSTed for an Event.
+type WebhookPayload struct {
+	Type       EventType         `json:"type"`
+	Id         string            `json:"id"`
+	Endpoint   string            `json:"endpoint,omitempty"`
+	Data       map[string]string `json:"data,omitempty"`
+	SDP        string            `json:"sdp,omitempty"` // BASE64
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Time       time.Time         `json:"time"`
+	DurationMs int64             `json:"duration_ms,omitempty"`
+}
+
+// DeadLetter is a delivery the WebhookDispatcher gave up on.
+type DeadLetter struct {
+	URL      string          `json:"url"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Time     time.Time       `json:"time"`
+}
+
+type webhookDelivery struct {
+	url       string
+	eventType EventType
+	payload   []byte
+}
+
+// WebhookDispatcher is an Observer POSTing events to URLs, signed with
+// WebhookSignatureHeader. Deliveries are queued and sent by workers,
+// retried with exponential backoff and dead-lettered when they keep failing
+// or the queue is full.
+type WebhookDispatcher struct {
+	urls   []string
+	secret []byte
+
+	client      *http.Client
+	filter      func(event *Event) bool
+	queueSize   int
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	logger      *slog.Logger
+
+	maxDeadLetters int
+	deadLetterLog  io.Writer
+	deadLetters    []*DeadLetter
+	deadLettersM   sync.Mutex
+
+	queue chan *webhookDelivery
+	// Cancelled when Close gives up, which aborts attempts and retries
+	ctx      context.Context
+	cancel   context.CancelFunc
+	closing  bool
+	closingM sync.RWMutex
+	wg       sync.WaitGroup
+}
+
+type WebhookOption func(wd *WebhookDispatcher)
+
+// WithWebhookFilter only delivers the events filter returns true for, e.g.
+// those of Endpoint "sdp_inform" and "sdp_store".
+func WithWebhookFilter(filter func(event *Event) bool) WebhookOption {
+	return func(wd *WebhookDispatcher) {
+		wd.filter = filter
+	}
+}
+
+// WithWebhookClient sends deliveries with client, which bounds how long one
+// attempt takes.
+func WithWebhookClient(client *http.Client) WebhookOption {
+	return func(wd *WebhookDispatcher) {
+		wd.client = client
+	}
+}
+
+// WithWebhookQueue bounds the deliveries waiting to be sent and sets how many
+// workers send them.
+func WithWebhookQueue(size, workers int) WebhookOption {
+	return func(wd *WebhookDispatcher) {
+		wd.queueSize, wd.workers = size, workers
+	}
+}
+
+// WithWebhookRetries makes up to maxAttempts attempts at a delivery, waiting
+// backoff after the first failure and doubling up to maxBackoff.
+func WithWebhookRetries(maxAttempts int, backoff, maxBackoff time.Duration) WebhookOption {
+	return func(wd *WebhookDispatcher) {
+		wd.maxAttempts, wd.backoff, wd.maxBackoff = maxAttempts, backoff, maxBackoff
+	}
+}
+
+// WithWebhookDeadLetterLog writes every DeadLetter to w as a line of JSON, on
+// top of keeping the latest ones for DeadLetters.
+func WithWebhookDeadLetterLog(w io.Writer) WebhookOption {
+	return func(wd *WebhookDispatcher) {
+		wd.deadLetterLog = w
+	}
+}
+
+// WithWebhookLogger logs failed attempts to logger.
+func WithWebhookLogger(logger *slog.Logger) WebhookOption {
+	return func(wd *WebhookDispatcher) {
+		wd.logger = logger
+	}
+}
+
+// NewWebhookDispatcher delivers every event to each of urls, signed with
+// secret, until Close. Pass it to WithObserver.
+func NewWebhookDispatcher(secret []byte, urls []string, options ...WebhookOption) (wd *WebhookDispatcher) {
+	wd = &WebhookDispatcher{
+		urls:           append([]string(nil), urls...),
+		secret:         secret,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		queueSize:      DefaultWebhookQueueSize,
+		workers:        DefaultWebhookWorkers,
+		maxAttempts:    DefaultWebhookMaxAttempts,
+		backoff:        DefaultWebhookBackoff,
+		maxBackoff:     DefaultWebhookMaxBackoff,
+		logger:         slog.New(slog.DiscardHandler),
+		maxDeadLetters: DefaultWebhookDeadLetters,
+	}
+	wd.ctx, wd.cancel = context.WithCancel(context.Background())
+
+	for _, option := range options {
+		option(wd)
+	}
+
+	if wd.workers < 1 {
+		wd.workers = 1
+	}
+
+	if wd.maxAttempts < 1 {
+		wd.maxAttempts = 1
+	}
+
+	wd.queue = make(chan *webhookDelivery, wd.queueSize)
+
+	for i := 0; i < wd.workers; i++ {
+		wd.wg.Add(1)
+		go wd.work()
+	}
+
+	return
+}
+
+// Observe queues event for every URL; deliveries that do not fit in the queue
+// are dead-lettered at once.
+func (wd *WebhookDispatcher) Observe(event *Event) {
+	if wd.filter != nil && !wd.filter(event) {
+		return
+	}
+
+	payload, err := json.Marshal(&WebhookPayload{
+		Type:       event.Type,
+		Id:         event.Id,
+		Endpoint:   event.Endpoint,
+		Data:       event.Data,
+		SDP:        event.SDP,
+		RemoteAddr: event.RemoteAddr,
+		RequestID:  event.RequestID,
+		Time:       event.Time,
+		DurationMs: event.Duration.Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+
+	wd.closingM.RLock()
+	defer wd.closingM.RUnlock()
+
+	for _, url := range wd.urls {
+		delivery := &webhookDelivery{url: url, eventType: event.Type, payload: payload}
+
+		if wd.closing {
+			wd.deadLetter(delivery, 0, "dispatcher_closed")
+			continue
+		}
+
+		select {
+		case wd.queue <- delivery:
+		default:
+			wd.deadLetter(delivery, 0, "queue_full")
+		}
+	}
+}
+
+// Close stops taking events and waits, until ctx is done, for the queued
+// deliveries to be sent. When ctx is done, attempts in flight are aborted and
+// they, their retries and the deliveries still queued are dead-lettered.
+func (wd *WebhookDispatcher) Close(ctx context.Context) (err error) {
+	wd.closingM.Lock()
+	if !wd.closing {
+		wd.closing = true
+		close(wd.queue)
+	}
+	wd.closingM.Unlock()
+
+	defer wd.cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		wd.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		wd.cancel()
+		<-drained
+		err = ctx.Err()
+	}
+
+	return
+}
+
+// DeadLetters returns the latest deliveries given up on, oldest first.
+func (wd *WebhookDispatcher) DeadLetters() (deadLetters []*DeadLetter) {
+	wd.deadLettersM.Lock()
+	defer wd.deadLettersM.Unlock()
+
+	deadLetters = append(deadLetters, wd.deadLetters...)
+	return
+}
+
+func (wd *WebhookDispatcher) work() {
+	defer wd.wg.Done()
+
+	for delivery := range wd.queue {
+		if wd.ctx.Err() != nil {
+			wd.deadLetter(delivery, 0, "dispatcher_closed")
+			continue
+		}
+
+		wd.deliver(delivery)
+	}
+}
+
+// deliver makes attempts at delivery until one succeeds, the response says
+// retrying will not help or maxAttempts is reached.
+func (wd *WebhookDispatcher) deliver(delivery *webhookDelivery) {
+	backoff := wd.backoff
+
+	for attempt := 1; ; attempt++ {
+		retry, err := wd.attempt(delivery, attempt)
+		if err == nil {
+			return
+		}
+
+		wd.logger.Warn("webhook delivery failed", "url", delivery.url, "event", delivery.eventType, "attempt", attempt, "error", err.Error())
+
+		if wd.ctx.Err() != nil {
+			wd.deadLetter(delivery, attempt, "dispatcher_closed: "+err.Error())
+			return
+		}
+
+		if !retry || attempt >= wd.maxAttempts {
+			wd.deadLetter(delivery, attempt, err.Error())
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-wd.ctx.Done():
+			wd.deadLetter(delivery, attempt, "dispatcher_closed: "+err.Error())
+			return
+		}
+
+		backoff *= 2
+		if backoff > wd.maxBackoff {
+			backoff = wd.maxBackoff
+		}
+	}
+}
+
+// attempt POSTs delivery once. Network errors, 408, 429 and 5xx are worth
+// retrying, other failures are not.
+func (wd *WebhookDispatcher) attempt(delivery *webhookDelivery, attempt int) (retry bool, err error) {
+	request, err := http.NewRequestWithContext(wd.ctx, http.MethodPost, delivery.url, bytes.NewReader(delivery.payload))
+	if err != nil {
+		return
+	}
+
+	timestamp := time.Now().Unix()
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookSignatureHeader, SignWebhook(wd.secret, timestamp, delivery.payload))
+	request.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(WebhookEventHeader, string(delivery.eventType))
+	request.Header.Set(WebhookAttemptHeader, fmt.Sprint(attempt))
+
+	response, err := wd.client.Do(request)
+	if err != nil {
+		retry = true
+		return
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return
+	}
+
+	retry = response.StatusCode >= http.StatusInternalServerError ||
+		response.StatusCode == http.StatusRequestTimeout ||
+		response.StatusCode == http.StatusTooManyRequests
+	err = fmt.Errorf("webhook_status_%d", response.StatusCode)
+	return
+}
+
+func (wd *WebhookDispatcher) deadLetter(delivery *webhookDelivery, attempts int, reason string) {
+	deadLetter := &DeadLetter{
+		URL:      delivery.url,
+		Payload:  delivery.payload,
+		Attempts: attempts,
+		Error:    reason,
+		Time:     time.Now(),
+	}
+
+	wd.deadLettersM.Lock()
+	defer wd.deadLettersM.Unlock()
+
+	wd.deadLetters = append(wd.deadLetters, deadLetter)
+	if len(wd.deadLetters) > wd.maxDeadLetters {
+		wd.deadLetters = wd.deadLetters[len(wd.deadLetters)-wd.maxDeadLetters:]
+	}
+
+	if wd.deadLetterLog != nil {
+		line, _ := json.Marshal(deadLetter)
+		wd.deadLetterLog.Write(append(line, '\n'))
+	}
+}
+
+// SignWebhook is the WebhookSignatureHeader of body sent at timestamp, in
+// Unix seconds, under secret.
+func SignWebhook(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature tells a receiver whether signature, the
+// WebhookSignatureHeader of a delivery, is the one of body and timestamp, its
+// WebhookTimestampHeader, under secret. Deliveries sent more than maxAge ago
+// or ahead are refused as replays, e.g. with DefaultWebhookMaxAge.
+func VerifyWebhookSignature(secret, body []byte, timestamp, signature string, maxAge time.Duration) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	if age := time.Since(time.Unix(sent, 0)); age > maxAge || age < -maxAge {
+		return false
+	}
+
+	return hmac.Equal([]byte(SignWebhook(secret, sent, body)), []byte(signature))
+}
@@ -0,0 +1,192 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	secret := []byte("webhook-secret")
+
+	var attempts atomic.Int32
+	payloads := make(chan *WebhookPayload, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		timestamp := request.Header.Get(WebhookTimestampHeader)
+		if !VerifyWebhookSignature(secret, body, timestamp, request.Header.Get(WebhookSignatureHeader), DefaultWebhookMaxAge) {
+			t.Errorf("bad signature %q", request.Header.Get(WebhookSignatureHeader))
+		}
+
+		// Fails twice before taking the delivery
+		if attempts.Add(1) <= 2 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var payload *WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+		payloads <- payload
+	}))
+	defer receiver.Close()
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	deadLetterLog := &syncBuffer{}
+	webhooks := NewWebhookDispatcher(secret, []string{receiver.URL, rejecting.URL},
+		WithWebhookRetries(3, time.Millisecond, 4*time.Millisecond),
+		WithWebhookDeadLetterLog(deadLetterLog),
+		WithWebhookFilter(func(event *Event) bool {
+			return event.Endpoint == "sdp_inform" || event.Endpoint == "sdp_store"
+		}),
+	)
+
+	ss := New(WithObserver(webhooks))
+
+	offer, err := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(ss.Handler())
+	defer server.Close()
+
+	// Not delivered, the filter drops events outside of requests
+	if _, err = ss.AddSDPListener("publisher"); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := http.Post(server.URL+"/sdp_store", "application/json", strings.NewReader(`{"id":"stored","sdp":"`+offer+`","data":{"room":"lobby"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if err = webhooks.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := <-payloads
+	if payload.Type != EventSDPStored || payload.Id != "stored" || payload.Endpoint != "sdp_store" || payload.Data["room"] != "lobby" || payload.SDP == "" {
+		t.Errorf("payload = %+v", payload)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("receiver got %d attempts, want 3", got)
+	}
+
+	deadLetters := webhooks.DeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].URL != rejecting.URL || deadLetters[0].Attempts != 1 || deadLetters[0].Error != "webhook_status_400" {
+		t.Fatalf("DeadLetters() = %+v", deadLetters)
+	}
+	if !strings.Contains(deadLetterLog.String(), `"error":"webhook_status_400"`) {
+		t.Errorf("dead-letter log = %s", deadLetterLog.String())
+	}
+}
+
+func TestWebhookDispatcher_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-release
+	}))
+	defer receiver.Close()
+
+	webhooks := NewWebhookDispatcher([]byte("secret"), []string{receiver.URL}, WithWebhookQueue(1, 1))
+
+	// The worker takes the first, the second waits in the queue
+	webhooks.Observe(&Event{Type: EventSDPStored, Id: "first"})
+	time.Sleep(20 * time.Millisecond)
+	webhooks.Observe(&Event{Type: EventSDPStored, Id: "second"})
+	webhooks.Observe(&Event{Type: EventSDPStored, Id: "third"})
+
+	close(release)
+	if err := webhooks.Close(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters := webhooks.DeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].Error != "queue_full" || !strings.Contains(string(deadLetters[0].Payload), `"id":"third"`) {
+		t.Errorf("DeadLetters() = %+v", deadLetters)
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret, body := []byte("secret"), []byte(`{"type":"sdp_stored"}`)
+
+	now := time.Now().Unix()
+	old := now - int64(DefaultWebhookMaxAge/time.Second) - 1
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		want      bool
+	}{
+		{name: "valid", timestamp: strconv.FormatInt(now, 10), signature: SignWebhook(secret, now, body), want: true},
+		{name: "replayed", timestamp: strconv.FormatInt(old, 10), signature: SignWebhook(secret, old, body)},
+		{name: "other_timestamp", timestamp: strconv.FormatInt(now, 10), signature: SignWebhook(secret, now-1, body)},
+		{name: "missing_timestamp", signature: SignWebhook(secret, now, body)},
+		{name: "wrong_secret", timestamp: strconv.FormatInt(now, 10), signature: SignWebhook([]byte("guess"), now, body)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyWebhookSignature(secret, body, tt.timestamp, tt.signature, DefaultWebhookMaxAge); got != tt.want {
+				t.Errorf("VerifyWebhookSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookDispatcher_CloseAborts(t *testing.T) {
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-release
+	}))
+	defer receiver.Close()
+	defer close(release)
+
+	webhooks := NewWebhookDispatcher([]byte("secret"), []string{receiver.URL},
+		WithWebhookQueue(4, 1),
+		WithWebhookClient(&http.Client{}),
+	)
+
+	// The worker hangs on the first, the others wait in the queue
+	webhooks.Observe(&Event{Type: EventSDPStored, Id: "first"})
+	time.Sleep(20 * time.Millisecond)
+	webhooks.Observe(&Event{Type: EventSDPStored, Id: "second"})
+	webhooks.Observe(&Event{Type: EventSDPStored, Id: "third"})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	if err := webhooks.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Close() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if waited := time.Since(started); waited > time.Second {
+		t.Errorf("Close() waited %s for the attempt in flight", waited)
+	}
+
+	deadLetters := webhooks.DeadLetters()
+	if len(deadLetters) != 3 {
+		t.Fatalf("DeadLetters() = %+v, want all three", deadLetters)
+	}
+	for _, deadLetter := range deadLetters {
+		if !strings.HasPrefix(deadLetter.Error, "dispatcher_closed") {
+			t.Errorf("dead letter error = %q", deadLetter.Error)
+		}
+	}
+}
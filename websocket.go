@@ -0,0 +1,462 @@
+package webrtcsignalingserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	wsWriteWait    = 10 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsPingPeriod   = wsPongWait * 9 / 10
+	wsMaxFrameSize = 1 << 20
+)
+
+type wsFrameType string
+
+const (
+	wsFrameOffer           wsFrameType = "offer"
+	wsFrameAnswer          wsFrameType = "answer"
+	wsFrameCandidate       wsFrameType = "candidate"
+	wsFrameEndOfCandidates wsFrameType = "end_of_candidates"
+	wsFrameMessage         wsFrameType = "message"
+	wsFrameError           wsFrameType = "error"
+)
+
+type wsFrame struct {
+	Type      wsFrameType              `json:"type"`
+	SDP       string                   `json:"sdp,omitempty"` // BASE64
+	Candidate *webrtc.ICECandidateInit `json:"candidate,omitempty"`
+	Message   json.RawMessage          `json:"message,omitempty"`
+	Data      map[string]string        `json:"data,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+func (ss *SignalingServer) wsHandler(writer http.ResponseWriter, request *http.Request) {
+	if !websocket.IsWebSocketUpgrade(request) {
+		writeError(writer, ErrWebsocketUpgradeRequired)
+		return
+	}
+
+	id := request.URL.Query().Get("id")
+	if id == "" {
+		writeError(writer, ErrEmptyID)
+		return
+	}
+
+	if !ss.admit(writer, request, ActionHandshake, id) {
+		return
+	}
+
+	listener, err := ss.storage.GetSDPListener(id)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+
+	logger := ss.requestLogger(request.Context())
+	logger.Debug("listener consumed", "id", id)
+
+	if listener.IsSessionListener() {
+		// Offers come later as frames, the session carries no SDP
+		started := newEvent(request, "", id, nil)
+
+		release, ok := ss.acquireHandshake(writer)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := ss.handshakeContext(request)
+		session, err := listener.openSession(ctx, nil)
+		cancel()
+		release()
+
+		if err != nil {
+			ss.abandonHandshake(writer, started, nil, err)
+			return
+		}
+
+		listener = session.Listener
+	}
+
+	conn, err := wsUpgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		return
+	}
+
+	session := newWSSession(conn, listener)
+	session.principal = PrincipalFromContext(request.Context())
+	session.server, session.id = ss, id
+	session.logger, session.requestID = logger, RequestIDFromContext(request.Context())
+	session.spanContext = trace.SpanContextFromContext(request.Context())
+	session.remoteAddr = request.RemoteAddr
+	session.run()
+}
+
+type wsSession struct {
+	conn      *websocket.Conn
+	listener  *Listener
+	principal *Principal
+
+	// SDPs are rewritten by the middleware of server for the listener of id
+	server *SignalingServer
+	id     string
+
+	answers wsAnswerClock
+
+	// Releases the pending handshake the offer awaiting its answer holds
+	releaseOffer func()
+	releaseM     sync.Mutex
+	released     bool
+
+	// The upgrade request's, for every frame of the connection
+	logger      *slog.Logger
+	requestID   string
+	spanContext trace.SpanContext
+	remoteAddr  string
+
+	incoming chan *wsFrame
+	outgoing chan *wsFrame
+	done     chan struct{}
+}
+
+func newWSSession(conn *websocket.Conn, listener *Listener) *wsSession {
+	return &wsSession{
+		conn:     conn,
+		listener: listener,
+		incoming: make(chan *wsFrame, listenerBufferSize),
+		outgoing: make(chan *wsFrame, listenerBufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *wsSession) run() {
+	s.listener.emit(&ListenerEvent{Type: ListenerEventConnected})
+
+	go s.writeLoop()
+	go s.dispatchLoop()
+
+	code, reason := s.readLoop()
+	close(s.done)
+	s.ended()
+
+	s.listener.emit(&ListenerEvent{Type: ListenerEventDisconnected, CloseCode: code, Reason: reason})
+
+	// The listener or session served this connection only, nobody is left to
+	// answer; closing it also forgets the session
+	s.listener.Close(ErrClientDisconnected)
+}
+
+func (s *wsSession) readLoop() (code int, reason string) {
+	s.conn.SetReadLimit(wsMaxFrameSize)
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		s.listener.touch()
+		s.listener.emit(&ListenerEvent{Type: ListenerEventHeartbeat})
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, payload, err := s.conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return closeErr.Code, closeErr.Text
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				s.listener.emit(&ListenerEvent{Type: ListenerEventTimeout})
+				return websocket.CloseAbnormalClosure, "heartbeat_timeout"
+			}
+
+			return websocket.CloseAbnormalClosure, err.Error()
+		}
+
+		s.listener.touch()
+
+		var frame *wsFrame
+		err = json.Unmarshal(payload, &frame)
+		if err != nil || frame == nil {
+			s.sendError(ErrInvalidJSON)
+			continue
+		}
+
+		select {
+		case s.incoming <- frame:
+		case <-s.listener.done:
+			// writeLoop sends the close frame
+			return websocket.CloseGoingAway, s.listener.closeErr.Error()
+		}
+	}
+}
+
+// dispatchLoop hands frames to the listener separately from readLoop, so a
+// slow listener owner does not stop pongs and close frames from being read.
+func (s *wsSession) dispatchLoop() {
+	for {
+		select {
+		case frame := <-s.incoming:
+			err := s.dispatch(frame)
+			if err != nil {
+				s.sendError(err)
+			}
+		case <-s.listener.done:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *wsSession) dispatch(frame *wsFrame) (err error) {
+	switch frame.Type {
+	case wsFrameOffer, wsFrameAnswer:
+		if frame.Type == wsFrameOffer {
+			s.server.metrics.handshakeStarted("ws")
+
+			// Pending until answered, like a handshake over HTTP
+			var release func()
+			if release, err = s.server.reserveHandshake(); err != nil {
+				s.server.metrics.handshakeDone("ws", false)
+				return
+			}
+			s.offering(release)
+		}
+
+		err = s.dispatchSDP(frame)
+		if err != nil && frame.Type == wsFrameOffer {
+			s.answered()
+			s.server.metrics.handshakeDone("ws", false)
+		}
+	case wsFrameCandidate:
+		if frame.Candidate == nil {
+			err = ErrEmptyCandidate
+			return
+		}
+
+		if candidate, keep := s.server.filterTrickled(SDPFromClient, frame.Candidate); keep {
+			err = s.listener.WriteClientCandidate(*candidate)
+		}
+	case wsFrameEndOfCandidates:
+		err = s.listener.WriteClientEndOfCandidates()
+	case wsFrameMessage:
+		select {
+		case s.listener.clientMessage <- frame.Message:
+		case <-s.listener.done:
+			err = s.listener.closeErr
+		case <-s.done:
+		}
+	default:
+		err = ErrUnknownFrameType
+	}
+
+	return
+}
+
+func (s *wsSession) dispatchSDP(frame *wsFrame) (err error) {
+	var clientSDP *SDPClient
+	clientSDP, err = NewClientSDP(frame.SDP, frame.Data)
+	if err != nil {
+		return
+	}
+
+	err = checkSDPType(clientSDP, webrtc.NewSDPType(string(frame.Type)))
+	if err != nil {
+		return
+	}
+
+	err = s.server.rewriteClientSDP(s.id, s.principal, clientSDP)
+	if err != nil {
+		return
+	}
+
+	arrived := s.event(EventClientSDPArrived, clientSDP.Data())
+	arrived.SDP = clientSDP.Base64()
+	s.server.observe(arrived)
+
+	clientSDP.principal, clientSDP.requestID, clientSDP.spanContext = s.principal, s.requestID, s.spanContext
+
+	select {
+	case s.listener.clientSDP <- clientSDP:
+		s.listener.setState(ListenerClientDelivered)
+		s.logger.Info("client SDP delivered", "id", s.id, "type", string(frame.Type))
+		if frame.Type == wsFrameOffer {
+			s.answers.offered()
+		}
+	case <-s.listener.done:
+		err = s.listener.closeErr
+	case <-s.done:
+	}
+
+	return
+}
+
+func (s *wsSession) writeLoop() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		s.conn.Close()
+	}()
+
+	for {
+		var frame *wsFrame
+
+		select {
+		case frame = <-s.outgoing:
+		case serverSDP := <-s.listener.serverSDP:
+			frame = s.serverSDPFrame(serverSDP)
+		case <-s.listener.serverCandidates.ready:
+			candidate, ok := s.listener.serverCandidates.tryPop()
+			if !ok {
+				continue
+			}
+
+			filtered, keep := s.server.filterTrickled(SDPFromServer, candidate.Candidate)
+			if !keep {
+				continue
+			}
+
+			frame = &wsFrame{Type: wsFrameCandidate, Candidate: filtered}
+			if candidate.EndOfCandidates {
+				frame = &wsFrame{Type: wsFrameEndOfCandidates}
+			}
+		case message := <-s.listener.serverMessage:
+			frame = &wsFrame{Type: wsFrameMessage, Message: message}
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case <-s.listener.done:
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, s.listener.closeErr.Error())
+			s.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteWait))
+			return
+		case <-s.done:
+			return
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := s.conn.WriteJSON(frame); err != nil {
+			return
+		}
+	}
+}
+
+// serverSDPFrame is the frame of an answer, or an error frame when the
+// middleware rejects it.
+func (s *wsSession) serverSDPFrame(serverSDP *SDPServer) (frame *wsFrame) {
+	offeredAt, answering := s.answers.since()
+
+	err := s.server.rewriteServerSDP(s.id, s.principal, serverSDP)
+	if err != nil {
+		if answering {
+			s.answered()
+			s.server.metrics.handshakeDone("ws", false)
+		}
+
+		s.server.metrics.error(err)
+		logError(context.Background(), s.logger, err)
+		frame = &wsFrame{Type: wsFrameError, Error: publicText(err)}
+		return
+	}
+
+	if answering {
+		s.answered()
+		s.server.metrics.answered("ws", offeredAt)
+		s.server.metrics.handshakeDone("ws", true)
+	}
+
+	if serverSDP.sdp.Type == webrtc.SDPTypeAnswer {
+		answered := s.event(EventAnswerSent, serverSDP.Data)
+		if answering {
+			answered.Duration = answered.Time.Sub(offeredAt)
+		}
+		s.server.observe(answered)
+	}
+
+	s.logger.Info("server SDP returned", "id", s.id, "type", serverSDP.sdp.Type.String())
+
+	frame = &wsFrame{
+		Type: wsFrameType(serverSDP.sdp.Type.String()),
+		SDP:  serverSDP.SDPBase64,
+		Data: serverSDP.Data,
+	}
+	return
+}
+
+// offering holds the pending handshake of a new offer, releasing the one of
+// an offer it replaces.
+func (s *wsSession) offering(release func()) {
+	s.releaseM.Lock()
+	defer s.releaseM.Unlock()
+
+	if s.releaseOffer != nil {
+		s.releaseOffer()
+	}
+
+	s.releaseOffer = release
+	if s.released {
+		// The connection ended meanwhile
+		s.releaseOffer()
+		s.releaseOffer = nil
+	}
+}
+
+// answered releases the pending handshake of the offer, if any.
+func (s *wsSession) answered() {
+	s.releaseM.Lock()
+	defer s.releaseM.Unlock()
+
+	if s.releaseOffer != nil {
+		s.releaseOffer()
+		s.releaseOffer = nil
+	}
+}
+
+// ended releases the pending handshake of the offer and any offer dispatched
+// after the connection ended.
+func (s *wsSession) ended() {
+	s.releaseM.Lock()
+	defer s.releaseM.Unlock()
+
+	if s.releaseOffer != nil {
+		s.releaseOffer()
+		s.releaseOffer = nil
+	}
+	s.released = true
+}
+
+// event is an Event of the connection.
+func (s *wsSession) event(eventType EventType, data map[string]string) (event *Event) {
+	event = newEvent(nil, eventType, s.id, data)
+	event.Endpoint, event.RemoteAddr, event.RequestID = "ws", s.remoteAddr, s.requestID
+	return
+}
+
+func (s *wsSession) sendError(err error) {
+	s.server.metrics.error(err)
+	logError(context.Background(), s.logger, err)
+
+	select {
+	case s.outgoing <- &wsFrame{Type: wsFrameError, Error: publicText(err)}:
+	default:
+	}
+}
@@ -0,0 +1,235 @@
+package webrtcsignalingserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestWSHandler_OfferAnswer(t *testing.T) {
+	ss := New()
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(ss.wsHandler))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?id=publisher"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if event := <-listener.Events(); event.Type != ListenerEventConnected {
+		t.Fatalf("first event = %s, want %s", event.Type, ListenerEventConnected)
+	}
+
+	offer, _ := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	err = conn.WriteJSON(&wsFrame{Type: wsFrameOffer, SDP: offer, Data: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sdp, data := listener.ReadClientSDP()
+	if sdp.Type != webrtc.SDPTypeOffer || data["k"] != "v" {
+		t.Fatalf("ReadClientSDP() = %v, %v", sdp, data)
+	}
+
+	err = listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: "v=0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frame *wsFrame
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err = conn.ReadJSON(&frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Type != wsFrameAnswer {
+		t.Fatalf("frame type = %s, want %s", frame.Type, wsFrameAnswer)
+	}
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))
+	for event := range listener.Events() {
+		if event.Type == ListenerEventDisconnected {
+			if event.CloseCode != websocket.CloseNormalClosure {
+				t.Fatalf("close code = %d, want %d", event.CloseCode, websocket.CloseNormalClosure)
+			}
+			break
+		}
+	}
+	// Nobody is left to answer on the listener of the connection
+	select {
+	case <-listener.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener still open after the disconnect")
+	}
+	if _, err = listener.ReadSDPClientContext(t.Context()); !errors.Is(err, ErrClientDisconnected) {
+		t.Errorf("ReadSDPClientContext() after the disconnect = %v, want %v", err, ErrClientDisconnected)
+	}
+}
+
+func TestWSHandler_SessionClosedOnDisconnect(t *testing.T) {
+	ss := New()
+	listener, err := ss.AddSDPSessionListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close(nil)
+
+	sessions := make(chan *Session, 1)
+	go func() {
+		for session := range listener.Sessions() {
+			sessions <- session
+		}
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(ss.wsHandler))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?id=publisher"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := <-sessions
+	if count := listener.sessionCount(); count != 1 {
+		t.Fatalf("sessionCount() = %d, want 1", count)
+	}
+
+	conn.Close()
+
+	select {
+	case <-session.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session still open after the disconnect")
+	}
+	if session.closeErr != ErrClientDisconnected {
+		t.Errorf("session closed with %v, want %v", session.closeErr, ErrClientDisconnected)
+	}
+	if count := listener.sessionCount(); count != 0 {
+		t.Errorf("sessionCount() after the disconnect = %d, want 0", count)
+	}
+}
+
+func TestWSHandler_ListenerClosedMidStream(t *testing.T) {
+	ss := New()
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(ss.wsHandler))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?id=publisher"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if event := <-listener.Events(); event.Type != ListenerEventConnected {
+		t.Fatalf("first event = %s, want %s", event.Type, ListenerEventConnected)
+	}
+
+	// Nobody reads the offer or the messages, so dispatching blocks until Close
+	offer, _ := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	if err = conn.WriteJSON(&wsFrame{Type: wsFrameOffer, SDP: offer}); err != nil {
+		t.Fatal(err)
+	}
+	for range listenerBufferSize * 3 {
+		if err = conn.WriteJSON(&wsFrame{Type: wsFrameMessage, Message: []byte(`"hi"`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listener.Close(nil)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err = conn.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("read after Close = %v, want a going away close frame", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-listener.Events():
+			if event.Type != ListenerEventDisconnected {
+				continue
+			}
+			if err = listener.WriteClientMessage([]byte(`"late"`)); !errors.Is(err, ErrListenerClosed) {
+				t.Errorf("WriteClientMessage() after Close = %v, want %v", err, ErrListenerClosed)
+			}
+			return
+		case <-timeout:
+			t.Fatal("session did not end after the listener was closed")
+		}
+	}
+}
+
+func TestWSHandler_PendingOffer(t *testing.T) {
+	ss := New(WithMaxPendingHandshakes(1))
+	listener, err := ss.AddSDPListener("publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(ss.wsHandler))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?id=publisher"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	offer, _ := EncodeWebrtcSdpToBase64(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: testOfferSDP})
+	if err = conn.WriteJSON(&wsFrame{Type: wsFrameOffer, SDP: offer}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = listener.ReadSDPClientContext(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The offer awaiting its answer takes the only slot
+	recorder := httptest.NewRecorder()
+	ss.sdpHandShakerHandler(recorder, httptest.NewRequest(http.MethodPost, "/sdp_handshake", strings.NewReader(`{"id":"other","sdp":"`+offer+`"}`)))
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("handshake while a websocket offer is pending = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+
+	if err = listener.WriteServerSDP(&webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: testOfferSDP}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var frame *wsFrame
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err = conn.ReadJSON(&frame); err != nil || frame.Type != wsFrameAnswer {
+		t.Fatalf("frame = %+v, %v, want the answer", frame, err)
+	}
+
+	ss.pendingM.Lock()
+	pending := ss.pendingHandshakes
+	ss.pendingM.Unlock()
+	if pending != 0 {
+		t.Errorf("%d handshakes pending after the answer, want 0", pending)
+	}
+}